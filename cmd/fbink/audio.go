@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"kobo-anki/core"
+	"os/exec"
+	"strings"
+)
+
+// ============================================================
+// Audio: [sound:...] playback through an external player
+// ============================================================
+
+// AudioPlayer plays the sound files a card references.
+type AudioPlayer interface {
+	Play(paths []string) error
+}
+
+// audio is the active player, selected by the "audio_player" config key.
+var audio AudioPlayer = nopPlayer{}
+
+func newAudioPlayer(command string) AudioPlayer {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nopPlayer{}
+	}
+	return &commandPlayer{args: args}
+}
+
+// nopPlayer is used when no player is configured, and in tests.
+type nopPlayer struct{}
+
+func (nopPlayer) Play([]string) error { return nil }
+
+// commandPlayer runs a command such as "mpg123 -q" with the files appended,
+// in the background so the UI stays responsive. Playing again stops the
+// previous sound first.
+type commandPlayer struct {
+	args []string
+	cur  *exec.Cmd
+}
+
+func (p *commandPlayer) Play(paths []string) error {
+	if p.cur != nil {
+		p.cur.Process.Kill() // fails harmlessly if it already finished
+		p.cur = nil
+	}
+	cmd := exec.Command(p.args[0], append(p.args[1:], paths...)...)
+	if debug {
+		fmt.Printf("audio: %v\n", cmd.Args)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.cur = cmd
+	go cmd.Wait()
+	return nil
+}
+
+// cardSounds returns the paths of the sounds on both sides of the current
+// card that are present in the media folder, front first.
+func cardSounds() []string {
+	var paths []string
+	for _, name := range core.Sounds(displayFront() + "\n" + displayBack()) {
+		if p, err := core.MediaPath(dataDir, name); err == nil && fileExists(p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
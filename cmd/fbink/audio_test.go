@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"kobo-anki/core"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordingPlayer stands in for the audio player and notes what it's asked
+// to play.
+type recordingPlayer struct{ played [][]string }
+
+func (p *recordingPlayer) Play(paths []string) error {
+	p.played = append(p.played, paths)
+	return nil
+}
+
+func TestPlaySound(t *testing.T) {
+	setupImageScreen(t)
+	p := &recordingPlayer{}
+	audio = p
+	defer func() { audio, input = nopPlayer{}, nil }()
+
+	media := filepath.Join(dataDir, core.MediaDir)
+	os.MkdirAll(media, 0755)
+	os.WriteFile(filepath.Join(media, "fiets.mp3"), nil, 0644)
+	core.SaveCards(core.DeckCSVPath(dataDir, "dutch"), []core.Card{
+		{Front: "fiets [sound:fiets.mp3]", Back: "bicycle [sound:missing.mp3]"},
+	})
+	// Open the deck, show the answer, play by key and by tapping the button.
+	input = newStdinInput(strings.NewReader("1\nenter\np\n"))
+	run()
+	var play Rect
+	for _, el := range scene {
+		if el.ID == "play" {
+			play = el.Rect
+		}
+	}
+	if play.W == 0 {
+		t.Fatal("no play button on the back of a card with sound")
+	}
+	input = newStdinInput(strings.NewReader(fmt.Sprintf("1\nenter\ntap %d %d\n", play.X+play.W/2, play.Y+play.H/2)))
+	run()
+
+	want := [][]string{{filepath.Join(media, "fiets.mp3")}, {filepath.Join(media, "fiets.mp3")}}
+	if !reflect.DeepEqual(p.played, want) {
+		t.Errorf("played %q, want %q", p.played, want)
+	}
+}
+
+func TestNewAudioPlayer(t *testing.T) {
+	if _, ok := newAudioPlayer("  ").(nopPlayer); !ok {
+		t.Error("empty audio_player should not play anything")
+	}
+	p, ok := newAudioPlayer("mpg123 -q").(*commandPlayer)
+	if !ok || !reflect.DeepEqual(p.args, []string{"mpg123", "-q"}) {
+		t.Errorf("newAudioPlayer = %#v", p)
+	}
+}
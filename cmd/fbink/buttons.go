@@ -0,0 +1,81 @@
+package main
+
+import (
+	"kobo-anki/core"
+	"slices"
+	"time"
+
+	"github.com/open-spaced-repetition/go-fsrs/v3"
+)
+
+// ============================================================
+// Rating buttons
+// ============================================================
+
+// Rating button layouts (button_layout in anki-fbink.conf).
+const (
+	layoutGrid     = "grid"     // 2x2: Hard Good over Again Easy
+	layoutRow      = "row"      // Again Hard Good Easy in one row
+	layoutPassFail = "passfail" // Again and Good only
+)
+
+type ratingButton struct {
+	ID     string
+	Name   string
+	Rating fsrs.Rating
+}
+
+var (
+	btnAgain = ratingButton{"again", "Again", fsrs.Again}
+	btnHard  = ratingButton{"hard", "Hard", fsrs.Hard}
+	btnGood  = ratingButton{"good", "Good", fsrs.Good}
+	btnEasy  = ratingButton{"easy", "Easy", fsrs.Easy}
+)
+
+// ratingRows returns the rating buttons for the configured layout, top row
+// first, each row left to right.
+func ratingRows() [][]ratingButton {
+	var rows [][]ratingButton
+	switch cfg.ButtonLayout {
+	case layoutRow:
+		rows = [][]ratingButton{{btnAgain, btnHard, btnGood, btnEasy}}
+	case layoutPassFail:
+		rows = [][]ratingButton{{btnAgain, btnGood}}
+	default:
+		rows = [][]ratingButton{{btnHard, btnGood}, {btnAgain, btnEasy}}
+	}
+	if cfg.LeftHanded {
+		for _, row := range rows {
+			slices.Reverse(row)
+		}
+	}
+	return rows
+}
+
+// isRating reports whether id is one of the rating buttons.
+func isRating(id string) bool {
+	switch id {
+	case btnAgain.ID, btnHard.ID, btnGood.ID, btnEasy.ID:
+		return true
+	}
+	return false
+}
+
+// drawRatingButtons lays the rating buttons out in r, each labelled with
+// the interval the current card would get.
+func drawRatingButtons(r Rect, gap int) {
+	iv := core.Intervals(*currentCard, time.Now())
+	rows := ratingRows()
+	for i, rowRect := range splitV(r, len(rows), gap) {
+		for j, cell := range splitH(rowRect, len(rows[i]), gap) {
+			b := rows[i][j]
+			drawButton(b.ID, cell, ratingLabel(b.Name, iv[b.Rating]), FontMenu, cfg.SizeMenu/2)
+		}
+	}
+}
+
+// ratingLabel names a rating button with the interval the card would get,
+// e.g. "Good · 4d".
+func ratingLabel(name string, d time.Duration) string {
+	return name + " · " + core.FormatInterval(d)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRatingRows(t *testing.T) {
+	setupImageScreen(t)
+	ids := func() string {
+		var rows []string
+		for _, row := range ratingRows() {
+			var ids []string
+			for _, b := range row {
+				ids = append(ids, b.ID)
+			}
+			rows = append(rows, strings.Join(ids, " "))
+		}
+		return strings.Join(rows, " / ")
+	}
+	for _, tc := range []struct {
+		layout string
+		left   bool
+		want   string
+	}{
+		{layoutGrid, false, "hard good / again easy"},
+		{layoutGrid, true, "good hard / easy again"},
+		{layoutRow, false, "again hard good easy"},
+		{layoutPassFail, true, "good again"},
+	} {
+		cfg.ButtonLayout, cfg.LeftHanded = tc.layout, tc.left
+		if got := ids(); got != tc.want {
+			t.Errorf("%s (left-handed %v): %s, want %s", tc.layout, tc.left, got, tc.want)
+		}
+	}
+}
+
+// TestPassFailKeys checks that keys for buttons pass/fail mode hides do
+// nothing, while Good still rates.
+func TestPassFailKeys(t *testing.T) {
+	setupImageScreen(t)
+	defer func() { input = nil }()
+	cfg.ButtonLayout = layoutPassFail
+	input = newStdinInput(strings.NewReader("1\nenter\n2\n4\n3\nback\nq\n"))
+	run()
+	if n := reviewedCount(t); n != 1 {
+		t.Fatalf("reviewed %d cards, want 1", n)
+	}
+	if session.Ratings[btnGood.Rating] != 1 {
+		t.Fatalf("ratings %v, want one Good", session.Ratings)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ============================================================
+// Touch calibration
+// ============================================================
+
+// calibrationTargets are the screen points to tap: one near each corner.
+func calibrationTargets() [][2]int {
+	mx, my := screenW/10, screenH/10
+	return [][2]int{
+		{mx, my}, {screenW - mx, my},
+		{mx, screenH - my}, {screenW - mx, screenH - my},
+	}
+}
+
+// drawCalibrationTarget draws a cross at (x,y) with an instruction.
+func drawCalibrationTarget(x, y int, msg string) {
+	sceneClear()
+	renderer.Clear()
+	arm := screenW / 20
+	renderer.FillRect(Rect{x - arm, y - 2, 2 * arm, 4}, "BLACK")
+	renderer.FillRect(Rect{x - 2, y - arm, 4, 2 * arm}, "BLACK")
+	drawLabel(rectPct(0, 25, 100, 15), msg, FontMenu, cfg.SizeMenu/2, "")
+	renderer.Refresh()
+	drainInput()
+}
+
+// solveCalibration finds the touch geometry that maps raw[i] onto
+// targets[i]. Targets must be the left/right, top/bottom corner layout from
+// calibrationTargets. Scale comes from the slope between opposite sides, so
+// the panel's raw range is assumed to start at 0, as transformTouch does.
+func solveCalibration(targets, raw [][2]int) (touchGeometry, error) {
+	if len(targets) != 4 || len(raw) != 4 {
+		return touchGeometry{}, errors.New("need four calibration points")
+	}
+	// Raw movement between the left and right targets, and between the top
+	// and bottom ones, for each raw axis.
+	avg := func(axis int, i, j int) float64 { return float64(raw[i][axis]+raw[j][axis]) / 2 }
+	horiz := [2]float64{avg(0, 1, 3) - avg(0, 0, 2), avg(1, 1, 3) - avg(1, 0, 2)}
+	vert := [2]float64{avg(0, 2, 3) - avg(0, 0, 1), avg(1, 2, 3) - avg(1, 0, 1)}
+
+	var g touchGeometry
+	a, b := 0, 1 // raw axes along screen x and screen y
+	if abs(horiz[1]) > abs(horiz[0]) {
+		g.SwapXY = true
+		a, b = 1, 0
+	}
+	spanX := float64(targets[1][0] - targets[0][0])
+	spanY := float64(targets[2][1] - targets[0][1])
+	kx, ky := horiz[a]/spanX, vert[b]/spanY
+	if abs(horiz[b]) > abs(horiz[a])/2 || abs(vert[a]) > abs(vert[b])/2 || abs(kx) < 0.05 || abs(ky) < 0.05 {
+		return touchGeometry{}, errors.New("taps don't line up with the targets")
+	}
+	g.MirrorX, g.MirrorY = kx < 0, ky < 0
+	maxA, maxB := int(abs(kx)*float64(screenW)+0.5), int(abs(ky)*float64(screenH)+0.5)
+	if g.SwapXY {
+		g.MaxX, g.MaxY = maxB, maxA
+	} else {
+		g.MaxX, g.MaxY = maxA, maxB
+	}
+	return g, nil
+}
+
+func abs[T int | float64](v T) T {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// calibrate asks for taps on the four corner targets, solves for the touch
+// geometry and, once a tap on a centre target confirms it, saves it to the
+// config file. It gives up after three failed attempts, leaving the
+// previous geometry in place. Taps are read from input by their raw
+// position, so the geometry being replaced doesn't matter.
+func calibrate() error {
+	for attempt := 0; attempt < 3; attempt++ {
+		targets := calibrationTargets()
+		raw := make([][2]int, len(targets))
+		for i, p := range targets {
+			drawCalibrationTarget(p[0], p[1], fmt.Sprintf("Tap the centre of the cross (%d of %d)", i+1, len(targets)))
+			ev, err := nextTouch()
+			if err != nil {
+				return err
+			}
+			raw[i] = [2]int{ev.RawX, ev.RawY}
+		}
+		if debug {
+			fmt.Printf("Calibration raw points: %v\n", raw)
+		}
+		g, err := solveCalibration(targets, raw)
+		if err != nil {
+			continue
+		}
+
+		cx, cy := screenW/2, screenH/2
+		drawCalibrationTarget(cx, cy, "Tap the cross to confirm")
+		ev, err := nextTouch()
+		if err != nil {
+			return err
+		}
+		x, y := g.apply(ev.RawX, ev.RawY, screenW, screenH)
+		if tol := screenW / 10; abs(x-cx) <= tol && abs(y-cy) <= tol {
+			touch = g
+			return updateConfigFile(configPath, map[string]string{
+				"touch_max_x":    strconv.Itoa(g.MaxX),
+				"touch_max_y":    strconv.Itoa(g.MaxY),
+				"touch_swap_xy":  strconv.FormatBool(g.SwapXY),
+				"touch_mirror_x": strconv.FormatBool(g.MirrorX),
+				"touch_mirror_y": strconv.FormatBool(g.MirrorY),
+			})
+		}
+	}
+	return errors.New("calibration failed: taps didn't match the targets")
+}
+
+// nextTouch waits for the next tap or long-press, skipping keys, swipes
+// and ticks.
+func nextTouch() (Event, error) {
+	for {
+		ev, err := input.Next()
+		if err != nil || ev.Kind == EventTap || ev.Kind == EventLongPress {
+			return ev, err
+		}
+	}
+}
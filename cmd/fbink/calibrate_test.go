@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSolveCalibration(t *testing.T) {
+	setupImageScreen(t)
+	targets := calibrationTargets()
+	for _, want := range []touchGeometry{
+		rotationGeometry(0, 1072, 1448),
+		rotationGeometry(1, 4000, 3000),
+		rotationGeometry(2, 1072, 1448),
+		rotationGeometry(3, 1440, 1020),
+		{MaxX: 1440, MaxY: 1020, SwapXY: true},
+		{MaxX: 2000, MaxY: 3000, MirrorX: true},
+	} {
+		raw := make([][2]int, len(targets))
+		for i, p := range targets {
+			x, y := rawTouchFor(want, p[0], p[1])
+			// A slightly sloppy finger.
+			raw[i] = [2]int{x + i%2*3, y - i*2}
+		}
+		got, err := solveCalibration(targets, raw)
+		if err != nil {
+			t.Errorf("%+v: %v", want, err)
+			continue
+		}
+		near := func(a, b int) bool { return abs(a-b) <= b/50 }
+		if got.SwapXY != want.SwapXY || got.MirrorX != want.MirrorX || got.MirrorY != want.MirrorY ||
+			!near(got.MaxX, want.MaxX) || !near(got.MaxY, want.MaxY) {
+			t.Errorf("solved %+v, want %+v", got, want)
+		}
+	}
+
+	same := [][2]int{{500, 500}, {500, 500}, {500, 500}, {500, 500}}
+	if _, err := solveCalibration(targets, same); err == nil {
+		t.Error("identical taps should not calibrate")
+	}
+}
+
+// tapSource replays taps at fixed raw coordinates.
+type tapSource struct {
+	evs []evdevEvent
+	t   time.Time
+	now time.Time // time of the last event read
+}
+
+func (s *tapSource) tap(rawX, rawY int) {
+	s.t = s.t.Add(time.Second)
+	s.evs = append(s.evs,
+		evdevEvent{s.t, 1, 330, 1},
+		evdevEvent{s.t, 3, 53, int32(rawX)},
+		evdevEvent{s.t, 3, 54, int32(rawY)},
+		evdevEvent{s.t, 0, 0, 0},
+		evdevEvent{s.t, 1, 330, 0},
+		evdevEvent{s.t, 0, 0, 0},
+	)
+}
+
+func (s *tapSource) ReadEvent() (evdevEvent, error) {
+	if len(s.evs) == 0 {
+		return evdevEvent{}, io.EOF
+	}
+	ev := s.evs[0]
+	s.evs = s.evs[1:]
+	s.now = ev.Time
+	return ev, nil
+}
+
+func (s *tapSource) Drain() {}
+
+// TestCalibrate runs the calibration screens on a panel whose real geometry
+// differs from the profile, and checks the result is used and saved.
+func TestCalibrate(t *testing.T) {
+	setupImageScreen(t)
+	saved := touch
+	defer func() {
+		touch = saved
+		touchSource, input = nil, nil
+		clock = time.Now
+		configPath = "./anki-fbink.conf"
+	}()
+
+	configPath = filepath.Join(t.TempDir(), "anki-fbink.conf")
+	os.WriteFile(configPath, []byte("# display\ndarkmode=false\n# touch_max_x=1440\n"), 0644)
+
+	real := rotationGeometry(1, 4000, 3000)
+	src := &tapSource{t: time.Unix(1700000000, 0)}
+	for _, p := range append(calibrationTargets(), [2]int{screenW / 2, screenH / 2}) {
+		src.tap(rawTouchFor(real, p[0], p[1]))
+	}
+	touchSource = src
+	input = touchInput{}
+	clock = func() time.Time { return src.now }
+
+	if err := calibrate(); err != nil {
+		t.Fatal(err)
+	}
+	if !touch.SwapXY || touch.MirrorX || !touch.MirrorY {
+		t.Fatalf("calibrated geometry %+v, want %+v", touch, real)
+	}
+	data, _ := os.ReadFile(configPath)
+	conf := string(data)
+	for _, want := range []string{"# display\ndarkmode=false\ntouch_max_x=", "touch_swap_xy=true", "touch_mirror_y=true"} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("config missing %q:\n%s", want, conf)
+		}
+	}
+}
+
+func TestUpdateConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.conf")
+	os.WriteFile(path, []byte("# sizes\nsize_card=28\n#darkmode=true\nsize_card=30\n"), 0644)
+	if err := updateConfigFile(path, map[string]string{"size_card": "32", "darkmode": "false", "renderer": "batch"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	want := "# sizes\nsize_card=32\ndarkmode=false\nsize_card=32\nrenderer=batch\n"
+	if string(data) != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+// stepInput returns the event each step builds when it is asked for, so a
+// step can look at the screen drawn before it.
+type stepInput struct{ steps []func() Event }
+
+func (s *stepInput) Next() (Event, error) {
+	if len(s.steps) == 0 {
+		return Event{}, io.EOF
+	}
+	step := s.steps[0]
+	s.steps = s.steps[1:]
+	return step(), nil
+}
+
+func (s *stepInput) Drain() {}
+
+// TestCalibrateFromSettings calibrates a panel that is mirrored left to
+// right via the settings screen's full-width button.
+func TestCalibrateFromSettings(t *testing.T) {
+	setupImageScreen(t)
+	saved := touch
+	defer func() { touch = saved; input = nil; configPath = "./anki-fbink.conf" }()
+	configPath = filepath.Join(t.TempDir(), "anki-fbink.conf")
+	os.WriteFile(configPath, nil, 0644)
+
+	touch = touchGeometry{MaxX: 1072, MaxY: 1448}
+	real := touchGeometry{MaxX: 1072, MaxY: 1448, MirrorX: true}
+	tapAt := func(x, y int) func() Event {
+		return func() Event {
+			rx, ry := rawTouchFor(real, x, y)
+			sx, sy := transformTouch(rx, ry)
+			return Event{Kind: EventTap, X: sx, Y: sy, RawX: rx, RawY: ry}
+		}
+	}
+	steps := []func() Event{
+		func() Event { return Event{Kind: EventKey, Key: "s"} },
+		func() Event {
+			for _, el := range scene {
+				if el.ID == "calibrate" {
+					r := el.Rect
+					return tapAt(r.X+r.W/4, r.Y+r.H/2)()
+				}
+			}
+			t.Fatal("settings screen has no calibrate button")
+			return Event{}
+		},
+	}
+	for _, p := range append(calibrationTargets(), [2]int{screenW / 2, screenH / 2}) {
+		steps = append(steps, tapAt(p[0], p[1]))
+	}
+	input = &stepInput{steps: steps}
+	run()
+
+	if touch != real {
+		t.Fatalf("calibrated geometry %+v, want %+v", touch, real)
+	}
+	if data, _ := os.ReadFile(configPath); !strings.Contains(string(data), "touch_mirror_x=true") {
+		t.Errorf("calibration not saved:\n%s", data)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// ============================================================
+// Device profiles: screen and touch geometry per Kobo model
+// ============================================================
+
+// koboVersionFile holds the serial, firmware versions and, in its last
+// field, a device ID whose final three digits identify the model.
+const koboVersionFile = "/mnt/onboard/.kobo/version"
+
+// touchGeometry maps raw touch coordinates onto the screen. Raw axes are
+// swapped first, then mirrored, then scaled from 0..Max to screen pixels.
+type touchGeometry struct {
+	MaxX, MaxY       int // raw ranges as the panel reports them
+	SwapXY           bool
+	MirrorX, MirrorY bool // in screen orientation, i.e. after the swap
+}
+
+// apply converts a raw touch point to screen pixels for a w x h screen.
+func (g touchGeometry) apply(rawX, rawY, w, h int) (int, int) {
+	x, y, maxX, maxY := rawX, rawY, g.MaxX, g.MaxY
+	if g.SwapXY {
+		x, y, maxX, maxY = y, x, maxY, maxX
+	}
+	if maxX <= 0 || maxY <= 0 {
+		return x, y
+	}
+	if g.MirrorX {
+		x = maxX - x
+	}
+	if g.MirrorY {
+		y = maxY - y
+	}
+	return x * w / maxX, y * h / maxY
+}
+
+// rotationGeometry returns the swap/mirror flags for a touch panel mounted
+// at FBInk rotation rot (clockwise quarter turns from the framebuffer).
+func rotationGeometry(rot, maxX, maxY int) touchGeometry {
+	g := touchGeometry{MaxX: maxX, MaxY: maxY}
+	switch rot & 3 {
+	case 1:
+		g.SwapXY, g.MirrorY = true, true
+	case 2:
+		g.MirrorX, g.MirrorY = true, true
+	case 3:
+		g.SwapXY, g.MirrorX = true, true
+	}
+	return g
+}
+
+type deviceProfile struct {
+	Name                 string
+	ScreenW, ScreenH     int
+	DPI                  int
+	TouchMaxX, TouchMaxY int // 0 = ask the device (EVIOCGABS)
+	Rotation             int
+}
+
+// defaultDevice is assumed when the model can't be identified.
+const defaultDevice = 395
+
+// deviceProfiles is keyed by Kobo device ID (the number FBInk reports as
+// deviceId). Only the Clara BW has been checked on hardware. The other IDs
+// follow FBInk's device list and their screen sizes Kobo's specs, but none
+// of them is verified: they assume the Clara BW's panel orientation and,
+// with no touch ranges, read those from the device. The touch_* keys in
+// anki-fbink.conf, or -calibrate, override whatever is picked here.
+var deviceProfiles = map[int]deviceProfile{
+	376: {"Clara HD", 1072, 1448, 300, 0, 0, 3},     // unverified
+	377: {"Forma", 1440, 1920, 300, 0, 0, 3},        // unverified
+	380: {"Forma 32GB", 1440, 1920, 300, 0, 0, 3},   // unverified
+	383: {"Sage", 1440, 1920, 300, 0, 0, 3},         // unverified
+	386: {"Clara 2E", 1072, 1448, 300, 0, 0, 3},     // unverified
+	387: {"Elipsa", 1404, 1872, 227, 0, 0, 3},       // unverified
+	388: {"Libra 2", 1264, 1680, 300, 0, 0, 3},      // unverified
+	389: {"Elipsa 2E", 1404, 1872, 227, 0, 0, 3},    // unverified
+	390: {"Libra Colour", 1264, 1680, 300, 0, 0, 3}, // unverified
+	393: {"Clara Colour", 1072, 1448, 300, 0, 0, 3}, // unverified
+	395: {"Clara BW", 1072, 1448, 300, 1440, 1020, 3},
+}
+
+// versionDeviceID reads the device ID from the Kobo version file, or 0.
+func versionDeviceID(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	fields := strings.Split(strings.TrimSpace(string(data)), ",")
+	last := fields[len(fields)-1]
+	if len(last) < 3 {
+		return 0
+	}
+	id, err := strconv.Atoi(last[len(last)-3:])
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// parseFbinkState splits `fbink -e` output into key/value pairs. FBInk
+// prints shell assignments (viewWidth=1072;deviceName='Clara BW';...);
+// "key: value" lines are accepted too.
+func parseFbinkState(out string) map[string]string {
+	st := map[string]string{}
+	for _, f := range strings.FieldsFunc(out, func(r rune) bool { return r == ';' || r == '\n' }) {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			k, v, ok = strings.Cut(f, ":")
+		}
+		if ok {
+			st[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `'"`)
+		}
+	}
+	return st
+}
+
+// touchProbe is set when the touch ranges came from neither the profile
+// nor the config, so probeTouchRanges should ask the device.
+var touchProbe bool
+
+// deviceID is the Kobo device ID applyDeviceProfile settled on; 0 if
+// unknown.
+var deviceID int
+
+// applyDeviceProfile picks the profile for the device (config "device" key,
+// then the version file, then FBInk's ID) and sets the touch geometry, and
+// the screen size too unless FBInk already reported it. Touch keys from the
+// config override the profile.
+func applyDeviceProfile(fbinkID int, screenKnown bool) {
+	id := cfg.Device
+	if id == 0 {
+		id = versionDeviceID(koboVersionFile)
+	}
+	if id == 0 {
+		id = fbinkID
+	}
+	deviceID = id
+	touchProbe = false
+	p, ok := deviceProfiles[id]
+	if !ok {
+		p = deviceProfiles[defaultDevice]
+		touchProbe = true
+	}
+	if debug {
+		fmt.Printf("Device: id=%d profile=%s known=%v\n", id, p.Name, ok)
+	}
+
+	if !screenKnown {
+		screenW, screenH, screenDPI = p.ScreenW, p.ScreenH, p.DPI
+	}
+
+	maxX, maxY := p.TouchMaxX, p.TouchMaxY
+	if maxX == 0 || maxY == 0 {
+		// Until the device is asked, assume raw units are screen pixels.
+		maxX, maxY = screenW, screenH
+		if p.Rotation&1 == 1 {
+			maxX, maxY = screenH, screenW
+		}
+		touchProbe = true
+	}
+	touch = rotationGeometry(p.Rotation, maxX, maxY)
+
+	if cfg.TouchMaxX > 0 && cfg.TouchMaxY > 0 {
+		touch.MaxX, touch.MaxY = cfg.TouchMaxX, cfg.TouchMaxY
+		touchProbe = false
+	}
+	if cfg.TouchSwapXY != nil {
+		touch.SwapXY = *cfg.TouchSwapXY
+	}
+	if cfg.TouchMirrorX != nil {
+		touch.MirrorX = *cfg.TouchMirrorX
+	}
+	if cfg.TouchMirrorY != nil {
+		touch.MirrorY = *cfg.TouchMirrorY
+	}
+}
+
+// absMax returns the maximum of an absolute axis via EVIOCGABS.
+func absMax(fd int, code uint16) (int, bool) {
+	var info [6]int32 // struct input_absinfo: value, min, max, fuzz, flat, resolution
+	req := 0x80000000 | uintptr(unsafe.Sizeof(info))<<16 | 'E'<<8 | uintptr(0x40+code)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(&info)))
+	if errno != 0 || info[2] <= 0 {
+		return 0, false
+	}
+	return int(info[2]), true
+}
+
+// probeTouchRanges fills in touch ranges from the device itself when the
+// profile and config didn't provide them. Multitouch axes are preferred.
+func probeTouchRanges(fd int) {
+	if !touchProbe {
+		return
+	}
+	for _, codes := range [][2]uint16{{53, 54}, {0, 1}} { // ABS_MT_POSITION_X/Y, ABS_X/Y
+		x, okX := absMax(fd, codes[0])
+		y, okY := absMax(fd, codes[1])
+		if okX && okY {
+			touch.MaxX, touch.MaxY = x, y
+			if debug {
+				fmt.Printf("Touch ranges from device: %dx%d\n", x, y)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTouchGeometryClaraBW(t *testing.T) {
+	g := rotationGeometry(3, 1440, 1020)
+	// The original hard-coded Clara BW transform.
+	old := func(rawX, rawY int) (int, int) {
+		return (1020 - rawY) * 1072 / 1020, rawX * 1448 / 1440
+	}
+	for _, p := range [][2]int{{0, 0}, {1440, 1020}, {700, 300}, {100, 900}} {
+		x, y := g.apply(p[0], p[1], 1072, 1448)
+		wx, wy := old(p[0], p[1])
+		if x != wx || y != wy {
+			t.Errorf("raw %v: got (%d,%d), want (%d,%d)", p, x, y, wx, wy)
+		}
+	}
+}
+
+func TestRotationGeometry(t *testing.T) {
+	// A 100x200 screen; the touched point is near the top-left corner.
+	for rot, raw := range [][2]int{
+		0: {10, 20},
+		1: {180, 10}, // panel's X runs down the screen, from the bottom
+		2: {90, 180},
+		3: {20, 90},
+	} {
+		maxX, maxY := 100, 200
+		if rot&1 == 1 {
+			maxX, maxY = 200, 100
+		}
+		x, y := rotationGeometry(rot, maxX, maxY).apply(raw[0], raw[1], 100, 200)
+		if x != 10 || y != 20 {
+			t.Errorf("rotation %d: raw %v mapped to (%d,%d), want (10,20)", rot, raw, x, y)
+		}
+	}
+}
+
+func TestVersionDeviceID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "version")
+	os.WriteFile(path, []byte("N4181C1012345,4.1.15,4.38.23171,4.1.15,4.1.15,00000000-0000-0000-0000-000000000395\n"), 0644)
+	if id := versionDeviceID(path); id != 395 {
+		t.Fatalf("got %d, want 395", id)
+	}
+	if id := versionDeviceID(filepath.Join(t.TempDir(), "missing")); id != 0 {
+		t.Fatalf("missing file: got %d, want 0", id)
+	}
+}
+
+func TestParseFbinkState(t *testing.T) {
+	st := parseFbinkState("viewWidth=1264;viewHeight=1680;screenDPI=300;deviceName='Libra 2';deviceId=388;\n")
+	if st["viewWidth"] != "1264" || st["deviceId"] != "388" || st["deviceName"] != "Libra 2" {
+		t.Fatalf("shell format: %v", st)
+	}
+	st = parseFbinkState("viewWidth: 1072\nviewHeight: 1448\n")
+	if st["viewWidth"] != "1072" || st["viewHeight"] != "1448" {
+		t.Fatalf("colon format: %v", st)
+	}
+}
+
+func TestApplyDeviceProfile(t *testing.T) {
+	saved := touch
+	defer func() {
+		touch = saved
+		cfg.Device, cfg.TouchMaxX, cfg.TouchMaxY, cfg.TouchMirrorY = 0, 0, 0, nil
+		screenW, screenH, screenDPI = 1072, 1448, 300
+	}()
+
+	cfg.Device = 388
+	applyDeviceProfile(0, false)
+	if screenW != 1264 || screenH != 1680 {
+		t.Errorf("Libra 2 screen: %dx%d", screenW, screenH)
+	}
+	if !touchProbe || !touch.SwapXY || !touch.MirrorX {
+		t.Errorf("Libra 2 touch: %+v probe=%v", touch, touchProbe)
+	}
+
+	// Config keys win and turn off probing.
+	cfg.TouchMaxX, cfg.TouchMaxY = 4000, 3000
+	cfg.TouchMirrorY = parseFlag("true")
+	applyDeviceProfile(0, true)
+	if touchProbe || touch.MaxX != 4000 || touch.MaxY != 3000 || !touch.MirrorY {
+		t.Errorf("override: %+v probe=%v", touch, touchProbe)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Gestures: taps, swipes and long-presses from raw touch events
+// ============================================================
+
+var (
+	// swipeDistance is the minimum travel for a swipe, in percent of the
+	// screen width. Shorter movements are taps or long-presses.
+	swipeDistance = 15
+	// longPressTime is how long a finger must rest to count as a long-press.
+	longPressTime = 600 * time.Millisecond
+)
+
+// gestureActions maps each gesture to a comma-separated list of scene
+// element IDs; the first one present on the current screen is activated.
+// That lets one swipe rate a card while studying and turn the page in the
+// deck list. Overridden by gesture_* keys in anki-fbink.conf.
+var gestureActions = map[string]string{
+	"swipe_left":  "again,next",
+	"swipe_right": "good,prev",
+	"swipe_up":    "page-next",
+	"swipe_down":  "show",
+	"long_press":  "actions",
+}
+
+// gestureTracker follows one finger through evdev reports. Contact state
+// comes from BTN_TOUCH or ABS_MT_TRACKING_ID (-1 = lifted), whichever the
+// panel sends; only slot 0 is followed, so a second finger is ignored.
+// Panels that send neither only report positions while touched, and each
+// report is taken as a tap.
+type gestureTracker struct {
+	x, y       int // latest raw position
+	hasX, hasY bool
+	moved      bool // a position arrived since the last SYN_REPORT
+	slot       int32
+	contact    bool
+	signaled   bool // the panel sends BTN_TOUCH or ABS_MT_TRACKING_ID
+
+	down           bool
+	startX, startY int // screen coordinates at touch-down
+	rawX, rawY     int // raw coordinates at touch-down
+	endX, endY     int
+	startT         time.Time
+}
+
+// gesture is the tracker for touchSource, reset by drainTouch so a lift
+// discarded during a redraw can't join two touches into one swipe.
+var gesture gestureTracker
+
+// feed consumes one event and returns a gesture when a finger lifts.
+func (g *gestureTracker) feed(ev evdevEvent) (Event, bool) {
+	switch {
+	case ev.Type == 1 && ev.Code == 330: // EV_KEY BTN_TOUCH
+		g.contact, g.signaled = ev.Value != 0, true
+	case ev.Type == 3 && ev.Code == 47: // ABS_MT_SLOT
+		g.slot = ev.Value
+	case ev.Type == 3 && g.slot != 0:
+		// another finger
+	case ev.Type == 3 && ev.Code == 57: // ABS_MT_TRACKING_ID
+		g.contact, g.signaled = ev.Value >= 0, true
+	case ev.Type == 3 && (ev.Code == 0 || ev.Code == 53): // ABS_X or ABS_MT_POSITION_X
+		g.x, g.hasX, g.moved = int(ev.Value), true, true
+	case ev.Type == 3 && (ev.Code == 1 || ev.Code == 54): // ABS_Y or ABS_MT_POSITION_Y
+		g.y, g.hasY, g.moved = int(ev.Value), true, true
+	case ev.Type == 0 && ev.Code == 0: // SYN_REPORT
+		return g.sync(ev.Time)
+	}
+	return Event{}, false
+}
+
+func (g *gestureTracker) sync(t time.Time) (Event, bool) {
+	moved := g.moved
+	g.moved = false
+	if !g.signaled {
+		if moved && g.hasX && g.hasY {
+			if debug {
+				fmt.Printf("Raw: x=%d y=%d\n", g.x, g.y)
+			}
+			sx, sy := transformTouch(g.x, g.y)
+			return Event{Kind: EventTap, X: sx, Y: sy, RawX: g.x, RawY: g.y}, true
+		}
+		return Event{}, false
+	}
+	if g.contact && g.hasX && g.hasY {
+		sx, sy := transformTouch(g.x, g.y)
+		if !g.down {
+			if debug {
+				fmt.Printf("Raw: x=%d y=%d (down)\n", g.x, g.y)
+			}
+			g.down = true
+			g.startX, g.startY, g.startT = sx, sy, t
+			g.rawX, g.rawY = g.x, g.y
+		}
+		g.endX, g.endY = sx, sy
+		return Event{}, false
+	}
+	if !g.contact && g.down {
+		g.down = false
+		ev := classifyGesture(g.startX, g.startY, g.endX, g.endY, t.Sub(g.startT))
+		ev.RawX, ev.RawY = g.rawX, g.rawY
+		return ev, true
+	}
+	return Event{}, false
+}
+
+// classifyGesture turns a finished touch into a tap, swipe or long-press.
+// Swipes take the direction of the dominant axis; all gestures report the
+// point where the finger went down.
+func classifyGesture(x0, y0, x1, y1 int, held time.Duration) Event {
+	dx, dy := x1-x0, y1-y0
+	adx, ady := dx, dy
+	if adx < 0 {
+		adx = -adx
+	}
+	if ady < 0 {
+		ady = -ady
+	}
+	ev := Event{Kind: EventTap, X: x0, Y: y0}
+	switch {
+	case max(adx, ady) >= screenW*swipeDistance/100:
+		ev.Kind = EventSwipe
+		switch {
+		case adx >= ady && dx < 0:
+			ev.Dir = SwipeLeft
+		case adx >= ady:
+			ev.Dir = SwipeRight
+		case dy < 0:
+			ev.Dir = SwipeUp
+		default:
+			ev.Dir = SwipeDown
+		}
+	case held >= longPressTime:
+		ev.Kind = EventLongPress
+	}
+	return ev
+}
+
+// gestureTarget resolves a gesture to the first of its configured element
+// IDs that the current screen has registered.
+func gestureTarget(name string) string {
+	for _, id := range strings.Split(gestureActions[name], ",") {
+		if id = strings.TrimSpace(id); id != "" && inScene(id) {
+			return id
+		}
+	}
+	return ""
+}
+
+// inScene reports whether the current screen has registered id.
+func inScene(id string) bool {
+	for _, e := range scene {
+		if e.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"kobo-anki/core"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rawTouch is the inverse of transformTouch.
+func rawTouch(x, y int) (int, int) {
+	return rawTouchFor(touch, x, y)
+}
+
+// rawTouchFor is the inverse of g.apply for the current screen size.
+func rawTouchFor(g touchGeometry, x, y int) (int, int) {
+	maxX, maxY := g.MaxX, g.MaxY
+	if g.SwapXY {
+		maxX, maxY = maxY, maxX
+	}
+	x, y = x*maxX/screenW, y*maxY/screenH
+	if g.MirrorX {
+		x = maxX - x
+	}
+	if g.MirrorY {
+		y = maxY - y
+	}
+	if g.SwapXY {
+		x, y = y, x
+	}
+	return x, y
+}
+
+func TestClassifyGesture(t *testing.T) {
+	screenW = 1072
+	for _, tc := range []struct {
+		name           string
+		x0, y0, x1, y1 int
+		held           time.Duration
+		want           Event
+	}{
+		{"tap", 100, 200, 105, 198, 100 * time.Millisecond, Event{Kind: EventTap, X: 100, Y: 200}},
+		{"long press", 100, 200, 110, 200, time.Second, Event{Kind: EventLongPress, X: 100, Y: 200}},
+		{"swipe left", 800, 500, 300, 560, 200 * time.Millisecond, Event{Kind: EventSwipe, Dir: SwipeLeft, X: 800, Y: 500}},
+		{"swipe right", 300, 500, 800, 400, 200 * time.Millisecond, Event{Kind: EventSwipe, Dir: SwipeRight, X: 300, Y: 500}},
+		{"swipe up", 500, 900, 520, 300, 200 * time.Millisecond, Event{Kind: EventSwipe, Dir: SwipeUp, X: 500, Y: 900}},
+		{"slow swipe down", 500, 300, 480, 900, 2 * time.Second, Event{Kind: EventSwipe, Dir: SwipeDown, X: 500, Y: 300}},
+	} {
+		if got := classifyGesture(tc.x0, tc.y0, tc.x1, tc.y1, tc.held); got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestGestureTrackerMultitouch feeds a protocol-B swipe (tracking IDs, no
+// BTN_TOUCH) with a second finger landing midway, which must be ignored.
+func TestGestureTrackerMultitouch(t *testing.T) {
+	setupImageScreen(t)
+	t0 := time.Unix(1700000000, 0)
+	var evs []evdevEvent
+	at := func(ms int, typ, code uint16, val int32) {
+		evs = append(evs, evdevEvent{t0.Add(time.Duration(ms) * time.Millisecond), typ, code, val})
+	}
+	move := func(ms, x, y int) {
+		rx, ry := rawTouch(x, y)
+		at(ms, 3, 53, int32(rx))
+		at(ms, 3, 54, int32(ry))
+		at(ms, 0, 0, 0)
+	}
+	at(0, 3, 57, 7)
+	move(0, 900, 700)
+	move(50, 700, 700)
+	at(80, 3, 47, 1) // second finger in slot 1, far away
+	at(80, 3, 57, 8)
+	at(80, 3, 53, 10)
+	at(80, 3, 54, 10)
+	at(80, 0, 0, 0)
+	at(90, 3, 47, 0)
+	move(100, 400, 720)
+	at(150, 3, 57, -1)
+	at(150, 0, 0, 0)
+
+	var g gestureTracker
+	var got []Event
+	for _, ev := range evs {
+		if e, ok := g.feed(ev); ok {
+			got = append(got, e)
+		}
+	}
+	if len(got) != 1 || got[0].Kind != EventSwipe || got[0].Dir != SwipeLeft {
+		t.Fatalf("got %+v, want one left swipe", got)
+	}
+}
+
+// TestGestureTrackerPositionOnly feeds a panel that sends neither BTN_TOUCH
+// nor tracking IDs: every report with a position is a tap.
+func TestGestureTrackerPositionOnly(t *testing.T) {
+	setupImageScreen(t)
+	t0 := time.Unix(1700000000, 0)
+	var got []Event
+	var g gestureTracker
+	tap := func(x, y int) {
+		rx, ry := rawTouch(x, y)
+		for _, ev := range []evdevEvent{{t0, 3, 0, int32(rx)}, {t0, 3, 1, int32(ry)}, {t0, 0, 0, 0}} {
+			if e, ok := g.feed(ev); ok {
+				got = append(got, e)
+			}
+		}
+	}
+	tap(300, 400)
+	tap(600, 900)
+	if _, ok := g.feed(evdevEvent{t0, 0, 0, 0}); ok {
+		t.Error("a report without a position gave a tap")
+	}
+	if len(got) != 2 || got[0].Kind != EventTap || got[1].Kind != EventTap {
+		t.Fatalf("got %+v, want two taps", got)
+	}
+	for i, want := range [][2]int{{300, 400}, {600, 900}} {
+		if dx, dy := got[i].X-want[0], got[i].Y-want[1]; dx < -2 || dx > 2 || dy < -2 || dy > 2 {
+			t.Errorf("tap %d at %d,%d, want %d,%d", i, got[i].X, got[i].Y, want[0], want[1])
+		}
+	}
+
+	// A panel that has reported contact keeps being tracked as one after a
+	// drain, so a finger held through the redraw isn't taken for taps.
+	touchSource = &scriptSource{}
+	defer func() { touchSource = nil }()
+	gesture = gestureTracker{}
+	gesture.feed(evdevEvent{t0, 1, 330, 1})
+	drainTouch()
+	rx, ry := rawTouch(300, 400)
+	gesture.feed(evdevEvent{t0, 3, 53, int32(rx)})
+	gesture.feed(evdevEvent{t0, 3, 54, int32(ry)})
+	if e, ok := gesture.feed(evdevEvent{t0, 0, 0, 0}); ok {
+		t.Errorf("held finger after a drain gave %+v", e)
+	}
+}
+
+// TestGestureSession studies with swipes and buries a card via long-press.
+func TestGestureSession(t *testing.T) {
+	setupImageScreen(t)
+	defer func() { input = nil }()
+	input = newStdinInput(strings.NewReader(
+		"1\nswipe down\nswipe right\nlongpress 500 500\n1\nback\nq\n"))
+	run()
+
+	cards, err := core.LoadCards(core.DeckCSVPath(dataDir, "dutch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reviewed, buried int
+	for _, c := range cards {
+		switch {
+		case c.Reps > 0:
+			reviewed++
+		case c.Due.After(time.Now()):
+			buried++
+		}
+	}
+	if reviewed != 1 || buried != 1 {
+		t.Fatalf("reviewed %d, buried %d; want 1 each", reviewed, buried)
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ============================================================
+// Input sources: high-level events from touch, keys or stdin
+// ============================================================
+
+type EventKind int
+
+const (
+	EventTap EventKind = iota
+	EventSwipe
+	EventLongPress
+	EventKey
+	EventTick // no input; sent periodically by mergeInputs
+)
+
+type SwipeDir int
+
+const (
+	SwipeLeft SwipeDir = iota
+	SwipeRight
+	SwipeUp
+	SwipeDown
+)
+
+var swipeNames = map[string]SwipeDir{"left": SwipeLeft, "right": SwipeRight, "up": SwipeUp, "down": SwipeDown}
+
+func (d SwipeDir) String() string {
+	for name, v := range swipeNames {
+		if v == d {
+			return name
+		}
+	}
+	return "?"
+}
+
+// Event is a high-level input event. X/Y are screen pixels (for swipes,
+// where the finger went down); Key is a key name such as "next" or "1".
+type Event struct {
+	Kind       EventKind
+	X, Y       int
+	RawX, RawY int // touch position before transformTouch, for calibration
+	Dir        SwipeDir
+	Key        string
+}
+
+// InputSource produces Events for the main loop. Next returns io.EOF when
+// input has ended (no device, end of a replay, stdin closed).
+type InputSource interface {
+	Next() (Event, error)
+	// Drain discards input queued while the screen was redrawing.
+	Drain()
+}
+
+// input is the active source, chosen in main from the "input" and
+// "keyboard" config keys.
+var input InputSource
+
+// drainInput discards input queued during a redraw.
+func drainInput() {
+	if input != nil {
+		input.Drain()
+	}
+}
+
+// touchInput turns the evdev touch stream in touchSource into gestures,
+// ignoring any within touchCooldown of the previous one or of a redraw.
+type touchInput struct{}
+
+func (touchInput) Next() (Event, error) {
+	for {
+		ev, err := readTouch()
+		if err != nil {
+			return Event{}, err
+		}
+		now := clock()
+		if now.Sub(lastTouchTime) < touchCooldown {
+			if debug {
+				fmt.Printf("Touch ignored (cooldown)\n")
+			}
+			continue
+		}
+		lastTouchTime = now
+		return ev, nil
+	}
+}
+
+func (touchInput) Drain() { drainTouch() }
+
+// Linux key codes (linux/input-event-codes.h) for the keys we understand.
+var keyNames = map[uint16]string{
+	1:   "back",  // KEY_ESC
+	14:  "back",  // KEY_BACKSPACE
+	158: "back",  // KEY_BACK
+	28:  "enter", // KEY_ENTER
+	57:  "enter", // KEY_SPACE
+	96:  "enter", // KEY_KPENTER
+	2:   "1",
+	3:   "2",
+	4:   "3",
+	5:   "4",
+	16:  "q",     // KEY_Q
+	46:  "c",     // KEY_C
+	25:  "p",     // KEY_P
+	31:  "s",     // KEY_S
+	38:  "l",     // KEY_L
+	103: "prev",  // KEY_UP
+	105: "prev",  // KEY_LEFT
+	104: "prev",  // KEY_PAGEUP
+	115: "prev",  // KEY_VOLUMEUP
+	108: "next",  // KEY_DOWN
+	106: "next",  // KEY_RIGHT
+	109: "next",  // KEY_PAGEDOWN
+	114: "next",  // KEY_VOLUMEDOWN
+	193: "prev",  // KEY_F23: Kobo page-turn button, back
+	194: "next",  // KEY_F24: Kobo page-turn button, forward
+	116: "power", // KEY_POWER
+}
+
+// keyboardInput reads key presses from a generic evdev keyboard, such as
+// a Bluetooth page-turner.
+type keyboardInput struct {
+	src evdevSource
+}
+
+func (k keyboardInput) Next() (Event, error) {
+	for {
+		ev, err := k.src.ReadEvent()
+		if err != nil {
+			return Event{}, err
+		}
+		// EV_KEY press (1); ignore release (0) and autorepeat (2).
+		if ev.Type != 1 || ev.Value != 1 {
+			continue
+		}
+		name, ok := keyNames[ev.Code]
+		if debug {
+			fmt.Printf("Key: code=%d name=%q\n", ev.Code, name)
+		}
+		if ok {
+			return Event{Kind: EventKey, Key: name}, nil
+		}
+	}
+}
+
+func (k keyboardInput) Drain() { k.src.Drain() }
+
+// openKeyboard opens an evdev keyboard without grabbing it.
+func openKeyboard(path string) (keyboardInput, error) {
+	fd, err := syscall.Open(path, syscall.O_RDONLY, 0)
+	if err != nil {
+		return keyboardInput{}, fmt.Errorf("open keyboard: %v", err)
+	}
+	return keyboardInput{fdSource{fd}}, nil
+}
+
+// procInputDevices lists the kernel's input devices; a variable for tests.
+var procInputDevices = "/proc/bus/input/devices"
+
+// inputDevice is one entry of procInputDevices.
+type inputDevice struct {
+	Name     string
+	Handlers []string // e.g. "kbd", "event0"
+}
+
+// listInputDevices parses procInputDevices; nil if it can't be read.
+func listInputDevices() []inputDevice {
+	data, err := os.ReadFile(procInputDevices)
+	if err != nil {
+		return nil
+	}
+	var devs []inputDevice
+	for _, block := range strings.Split(string(data), "\n\n") {
+		var d inputDevice
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "N: Name="); ok {
+				d.Name = strings.Trim(name, `"`)
+			}
+			if h, ok := strings.CutPrefix(line, "H: Handlers="); ok {
+				d.Handlers = strings.Fields(h)
+			}
+		}
+		if d.Handlers != nil {
+			devs = append(devs, d)
+		}
+	}
+	return devs
+}
+
+// path returns the /dev/input/eventN node of the device, or "".
+func (d inputDevice) path() string {
+	for _, h := range d.Handlers {
+		if strings.HasPrefix(h, "event") {
+			return "/dev/input/" + h
+		}
+	}
+	return ""
+}
+
+// isPageKeys reports whether d is the Kobo's built-in key device, which
+// carries the page-turn buttons on the Libra, Sage and Forma.
+func (d inputDevice) isPageKeys() bool {
+	return strings.Contains(d.Name, "gpio-keys") || strings.Contains(d.Name, "gpio_keys")
+}
+
+// isPowerKey reports whether d may carry the power button: the built-in
+// keys on older models, a PMIC or keypad device on newer ones.
+func (d inputDevice) isPowerKey() bool {
+	name := strings.ToLower(d.Name)
+	return d.isPageKeys() || strings.Contains(name, "pwrkey") || strings.Contains(name, "power") || strings.Contains(name, "kpd")
+}
+
+// findKeyboardDevice returns the first evdev device with a keyboard handler
+// that is neither the touchscreen nor a built-in key device, or "" if there
+// is none.
+func findKeyboardDevice() string {
+	for _, d := range listInputDevices() {
+		if !slices.Contains(d.Handlers, "kbd") || d.isPowerKey() {
+			continue
+		}
+		if p := d.path(); p != "" && p != touchDevice {
+			return p
+		}
+	}
+	return ""
+}
+
+// findPageKeysDevice returns the built-in key device with the page-turn
+// buttons, or "" if there is none.
+func findPageKeysDevice() string {
+	for _, d := range listInputDevices() {
+		if d.isPageKeys() {
+			return d.path()
+		}
+	}
+	return ""
+}
+
+// findPowerKeyDevice returns the device the power button reports on, or ""
+// if there is none.
+func findPowerKeyDevice() string {
+	for _, d := range listInputDevices() {
+		if d.isPowerKey() {
+			return d.path()
+		}
+	}
+	return ""
+}
+
+// keyDevicePath resolves a keyboard/page_keys/power_key setting ("off", "auto" or a
+// path) to a device path, "" for none.
+func keyDevicePath(setting string, find func() string) string {
+	switch setting {
+	case "", "off":
+		return ""
+	case "auto":
+		return find()
+	}
+	return setting
+}
+
+// stdinInput reads one command per line, for driving the UI headlessly or
+// over a pty:
+//
+//	tap X Y | longpress X Y | swipe left|right|up|down | key NAME | NAME
+type stdinInput struct {
+	r *bufio.Scanner
+}
+
+func newStdinInput(r io.Reader) *stdinInput {
+	return &stdinInput{bufio.NewScanner(r)}
+}
+
+func parseCommand(line string) (Event, error) {
+	f := strings.Fields(line)
+	switch {
+	case len(f) == 3 && (f[0] == "tap" || f[0] == "longpress"):
+		x, err1 := strconv.Atoi(f[1])
+		y, err2 := strconv.Atoi(f[2])
+		if err1 != nil || err2 != nil {
+			break
+		}
+		kind := EventTap
+		if f[0] == "longpress" {
+			kind = EventLongPress
+		}
+		return Event{Kind: kind, X: x, Y: y}, nil
+	case len(f) == 2 && f[0] == "swipe":
+		if dir, ok := swipeNames[f[1]]; ok {
+			return Event{Kind: EventSwipe, Dir: dir}, nil
+		}
+	case len(f) == 2 && f[0] == "key":
+		return Event{Kind: EventKey, Key: f[1]}, nil
+	case len(f) == 1:
+		return Event{Kind: EventKey, Key: f[0]}, nil
+	}
+	return Event{}, fmt.Errorf("bad input command %q", line)
+}
+
+func (s *stdinInput) Next() (Event, error) {
+	for s.r.Scan() {
+		line := strings.TrimSpace(s.r.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		ev, err := parseCommand(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		return ev, nil
+	}
+	if err := s.r.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+// Drain is a no-op: piped commands are intentional, not stray taps.
+func (s *stdinInput) Drain() {}
+
+// mergedInput reads several sources concurrently, e.g. touch plus a
+// page-turner. Each source runs in its own goroutine but only reads when Next
+// asks it for an event, so a source that isn't mid-read can be drained
+// directly. One still blocked in a read can't be reached; whatever it
+// delivers from before the drain is discarded instead.
+type mergedInput struct {
+	srcs  []*mergedSource
+	ch    chan mergedEvent
+	live  int
+	drain time.Time
+	tick  <-chan time.Time // nil without a tick interval
+}
+
+type mergedSource struct {
+	src  InputSource
+	next chan struct{}
+	busy bool // asked for an event it hasn't delivered yet
+	done bool
+}
+
+type mergedEvent struct {
+	from *mergedSource
+	ev   Event
+	err  error
+	at   time.Time
+}
+
+// mergeInputs reads all of srcs and, if tick isn't zero, also returns an
+// EventTick every tick, so the app can check the battery and update the
+// clock while nobody touches it. It ends when all of srcs have.
+func mergeInputs(tick time.Duration, srcs ...InputSource) InputSource {
+	if len(srcs) == 1 && tick == 0 {
+		return srcs[0]
+	}
+	m := newMergedInput(srcs)
+	if tick > 0 {
+		m.tick = time.NewTicker(tick).C
+	}
+	return m
+}
+
+func newMergedInput(srcs []InputSource) *mergedInput {
+	m := &mergedInput{ch: make(chan mergedEvent, len(srcs)), live: len(srcs)}
+	for _, s := range srcs {
+		ms := &mergedSource{src: s, next: make(chan struct{}, 1)}
+		m.srcs = append(m.srcs, ms)
+		go ms.read(m.ch)
+	}
+	return m
+}
+
+func (ms *mergedSource) read(ch chan<- mergedEvent) {
+	for range ms.next {
+		for {
+			ev, err := ms.src.Next()
+			if errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) {
+				continue
+			}
+			// Anything else, e.g. ENODEV from an unplugged page-turner,
+			// ends this source.
+			ch <- mergedEvent{ms, ev, err, time.Now()}
+			if err != nil {
+				return
+			}
+			break
+		}
+	}
+}
+
+func (m *mergedInput) Next() (Event, error) {
+	for {
+		for _, ms := range m.srcs {
+			if !ms.busy && !ms.done {
+				ms.busy = true
+				ms.next <- struct{}{}
+			}
+		}
+		select {
+		case me := <-m.ch:
+			me.from.busy = false
+			if me.err != nil {
+				me.from.done = true
+				if m.live--; m.live == 0 {
+					return Event{}, io.EOF
+				}
+				continue
+			}
+			if me.at.Before(m.drain) {
+				continue
+			}
+			return me.ev, nil
+		case <-m.tick:
+			return Event{Kind: EventTick}, nil
+		}
+	}
+}
+
+func (m *mergedInput) Drain() {
+	m.drain = time.Now()
+	for _, ms := range m.srcs {
+		if !ms.busy && !ms.done {
+			ms.src.Drain()
+		}
+	}
+}
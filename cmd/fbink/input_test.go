@@ -0,0 +1,230 @@
+package main
+
+import (
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	for line, want := range map[string]Event{
+		"tap 10 20":     {Kind: EventTap, X: 10, Y: 20},
+		"longpress 5 6": {Kind: EventLongPress, X: 5, Y: 6},
+		"swipe left":    {Kind: EventSwipe, Dir: SwipeLeft},
+		"key next":      {Kind: EventKey, Key: "next"},
+		"enter":         {Kind: EventKey, Key: "enter"},
+	} {
+		got, err := parseCommand(line)
+		if err != nil || got != want {
+			t.Errorf("parseCommand(%q) = %+v, %v; want %+v", line, got, err, want)
+		}
+	}
+	for _, line := range []string{"tap x 1", "swipe sideways", "tap 1"} {
+		if _, err := parseCommand(line); err == nil {
+			t.Errorf("parseCommand(%q): expected error", line)
+		}
+	}
+}
+
+// TestStdinSession drives a whole study session with key commands, the way
+// a pty or Bluetooth page-turner would.
+func TestStdinSession(t *testing.T) {
+	setupImageScreen(t)
+	defer func() { input = nil }()
+	input = newStdinInput(strings.NewReader("1\nenter\n3\nnext\n3\nenter\nq\n"))
+	run()
+	if n := reviewedCount(t); n != 2 {
+		t.Fatalf("reviewed %d cards, want 2", n)
+	}
+	if session.Reviews() != 2 || session.New != 2 || session.Deck != "dutch" {
+		t.Fatalf("session %+v, want 2 new cards reviewed in dutch", session)
+	}
+	if _, err := input.Next(); err != io.EOF {
+		t.Fatalf("expected all commands consumed, got %v", err)
+	}
+}
+
+func TestMergeInputs(t *testing.T) {
+	a := newStdinInput(strings.NewReader("key next\n"))
+	b := newStdinInput(strings.NewReader("tap 1 2\n"))
+	m := mergeInputs(0, a, b)
+	seen := map[EventKind]bool{}
+	for {
+		ev, err := m.Next()
+		if err == io.EOF {
+			break
+		}
+		seen[ev.Kind] = true
+	}
+	if !seen[EventKey] || !seen[EventTap] {
+		t.Fatalf("merged input lost events: %v", seen)
+	}
+}
+
+func TestMergeInputsTick(t *testing.T) {
+	// A source that never delivers, like an untouched touchscreen.
+	idle, w := io.Pipe()
+	defer w.Close()
+	m := mergeInputs(10*time.Millisecond, newStdinInput(idle))
+	if ev, err := m.Next(); err != nil || ev.Kind != EventTick {
+		t.Fatalf("Next() = %+v, %v; want a tick", ev, err)
+	}
+
+	m = mergeInputs(time.Hour, newStdinInput(strings.NewReader("key next\n")))
+	if ev, err := m.Next(); err != nil || ev.Key != "next" {
+		t.Fatalf("Next() = %+v, %v; want key next", ev, err)
+	}
+	if _, err := m.Next(); err != io.EOF {
+		t.Fatalf("ticking input did not end with its source: %v", err)
+	}
+}
+
+// errSource returns its errors in turn, then io.EOF.
+// drainSource delivers evs one by one and counts Drain calls.
+type drainSource struct {
+	evs    []Event
+	drains int
+}
+
+func (s *drainSource) Next() (Event, error) {
+	if len(s.evs) == 0 {
+		return Event{}, io.EOF
+	}
+	ev := s.evs[0]
+	s.evs = s.evs[1:]
+	return ev, nil
+}
+
+func (s *drainSource) Drain() { s.drains++ }
+
+func TestMergedDrain(t *testing.T) {
+	// The touch source gets drained after every redraw, which resets the
+	// gesture tracker and, when recording, marks the drain in the log.
+	// Merging it with an idle page-turner or the status ticker must keep
+	// that working.
+	idle, w := io.Pipe()
+	defer w.Close()
+	touch := &drainSource{evs: []Event{{Kind: EventTap}, {Kind: EventTap}}}
+	m := mergeInputs(time.Hour, touch, newStdinInput(idle))
+	if ev, err := m.Next(); err != nil || ev.Kind != EventTap {
+		t.Fatalf("Next() = %+v, %v; want a tap", ev, err)
+	}
+	m.Drain()
+	if touch.drains != 1 {
+		t.Fatalf("Drain reached the touch source %d times; want 1", touch.drains)
+	}
+	// Only the tap asked for is read, so the one after it wasn't swallowed
+	// by the drain.
+	if ev, err := m.Next(); err != nil || ev.Kind != EventTap {
+		t.Fatalf("Next() after Drain = %+v, %v; want the second tap", ev, err)
+	}
+}
+
+type errSource struct{ errs []error }
+
+func (s *errSource) Next() (Event, error) {
+	if len(s.errs) == 0 {
+		return Event{}, io.EOF
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	if err == nil {
+		return Event{Kind: EventKey, Key: "next"}, nil
+	}
+	return Event{}, err
+}
+
+func (s *errSource) Drain() {}
+
+// TestMergeInputsErrors checks that EINTR is retried but a device that
+// went away ends its source instead of being read again forever.
+func TestMergeInputsErrors(t *testing.T) {
+	gone := &errSource{errs: []error{syscall.ENODEV, nil}}
+	interrupted := &errSource{errs: []error{syscall.EINTR, nil}}
+	m := mergeInputs(0, gone, interrupted)
+	var keys int
+	for {
+		ev, err := m.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || ev.Key != "next" {
+			t.Fatalf("Next() = %+v, %v", ev, err)
+		}
+		keys++
+	}
+	if keys != 1 {
+		t.Errorf("%d keys, want 1 (after EINTR, none after ENODEV)", keys)
+	}
+	if len(gone.errs) != 1 {
+		t.Errorf("source read %d more times after ENODEV", 1-len(gone.errs))
+	}
+}
+
+func TestFindKeyDevices(t *testing.T) {
+	saved := procInputDevices
+	defer func() { procInputDevices = saved }()
+	procInputDevices = filepath.Join(t.TempDir(), "devices")
+	os.WriteFile(procInputDevices, []byte(`I: Bus=0019 Vendor=0001 Product=0001 Version=0100
+N: Name="gpio-keys"
+H: Handlers=kbd event0
+
+I: Bus=0018 Vendor=0000 Product=0000 Version=0000
+N: Name="cyttsp5_mt"
+H: Handlers=event1
+
+I: Bus=0005 Vendor=05ac Product=0220 Version=0001
+N: Name="Page Turner"
+H: Handlers=sysrq kbd leds event3
+`), 0644)
+
+	if got := findPageKeysDevice(); got != "/dev/input/event0" {
+		t.Errorf("page keys: %q, want /dev/input/event0", got)
+	}
+	if got := findKeyboardDevice(); got != "/dev/input/event3" {
+		t.Errorf("keyboard: %q, want /dev/input/event3", got)
+	}
+	if got := keyDevicePath("off", findPageKeysDevice); got != "" {
+		t.Errorf("off: %q", got)
+	}
+	if got := keyDevicePath("/dev/input/event7", findPageKeysDevice); got != "/dev/input/event7" {
+		t.Errorf("explicit path: %q", got)
+	}
+}
+
+func TestPageKeys(t *testing.T) {
+	for code, want := range map[uint16]string{193: "prev", 194: "next"} {
+		k := keyboardInput{&tapSource{evs: []evdevEvent{{Type: 1, Code: code, Value: 1}}}}
+		ev, err := k.Next()
+		if err != nil || ev.Key != want {
+			t.Errorf("code %d: %+v, %v; want key %q", code, ev, err, want)
+		}
+	}
+}
+
+func TestSetScreenKeys(t *testing.T) {
+	defaults := maps.Clone(defaultKeys[ScreenBack])
+	defer func() { cfg.Keys = nil }()
+	setScreenKeys(ScreenBack, "next:easy, prev: ,bogus")
+	keys := screenKeys(ScreenBack)
+	if got := keys["next"]; got != "easy" {
+		t.Errorf("next = %q, want easy", got)
+	}
+	if _, ok := keys["prev"]; ok {
+		t.Error("prev still mapped")
+	}
+	if got := keys["1"]; got != "again" {
+		t.Errorf("unrelated key changed: %q", got)
+	}
+	if !maps.Equal(defaultKeys[ScreenBack], defaults) {
+		t.Errorf("defaultKeys changed: %v", defaultKeys[ScreenBack])
+	}
+	if got := screenKeys(ScreenFront)["next"]; got != "show" {
+		t.Errorf("front next = %q, want the default show", got)
+	}
+}
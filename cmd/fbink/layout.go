@@ -0,0 +1,263 @@
+package main
+
+import (
+	"kobo-anki/core"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// ============================================================
+// Text layout: measuring, wrapping, shrinking, paginating
+// ============================================================
+
+type faceKey struct {
+	path  string
+	style core.Style
+	size  int
+}
+
+var (
+	fontCache = map[faceKey]*opentype.Font{} // keyed with size 0
+	faceCache = map[faceKey]font.Face{}
+)
+
+// resolveStyledFont returns the TTF for a font in a style: the font_bold,
+// font_italic or font_bold_italic file if configured, else a sibling of the
+// regular file named like Name-Bold.ttf, else the regular file itself.
+func resolveStyledFont(ft FontType, st core.Style) string {
+	base := resolveFont(ft)
+	if base == "" || st == 0 {
+		return base
+	}
+	name, suffix := cfg.FontBoldItalic, "BoldItalic"
+	switch st {
+	case core.Bold:
+		name, suffix = cfg.FontBold, "Bold"
+	case core.Italic:
+		name, suffix = cfg.FontItalic, "Italic"
+	}
+	if name != "" {
+		return filepath.Join(cfg.FontDir, name)
+	}
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if i := strings.LastIndex(stem, "-"); i > len(filepath.Dir(stem)) {
+		stem = stem[:i]
+	}
+	if p := stem + "-" + suffix + ext; fileExists(p) {
+		return p
+	}
+	return base
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// goFonts stand in for the Kobo fonts when none are configured.
+var goFonts = map[core.Style][]byte{
+	0:                       goregular.TTF,
+	core.Bold:               gobold.TTF,
+	core.Italic:             goitalic.TTF,
+	core.Bold | core.Italic: gobolditalic.TTF,
+}
+
+// styledFace returns a cached face for the font in a style at the given
+// FBInk point size. Missing or unreadable fonts fall back to the Go fonts so
+// layout still works on machines without the Kobo fonts (and, on the
+// device, when FBInk falls back to its bitmap font).
+func styledFace(ft FontType, st core.Style, size int) font.Face {
+	path := resolveStyledFont(ft, st)
+	key := faceKey{path, st, size}
+	if f, ok := faceCache[key]; ok {
+		return f
+	}
+	fkey := faceKey{path, st, 0}
+	otf, ok := fontCache[fkey]
+	if !ok {
+		var data []byte
+		if path != "" {
+			data, _ = os.ReadFile(path)
+		}
+		var err error
+		if data != nil {
+			otf, err = opentype.Parse(data)
+		}
+		if data == nil || err != nil {
+			otf, _ = opentype.Parse(goFonts[st])
+		}
+		fontCache[fkey] = otf
+	}
+	f, err := opentype.NewFace(otf, &opentype.FaceOptions{
+		Size:    float64(size),
+		DPI:     float64(screenDPI),
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil
+	}
+	faceCache[key] = f
+	return f
+}
+
+func fontFace(ft FontType, size int) font.Face {
+	return styledFace(ft, 0, size)
+}
+
+// lineWidth measures a styled line in pixels.
+func lineWidth(l core.Line, ft FontType, size int) int {
+	var w fixed.Int26_6
+	for _, sp := range l {
+		if f := styledFace(ft, sp.Style, size); f != nil {
+			w += font.MeasureString(f, sp.Text)
+		}
+	}
+	return w.Ceil()
+}
+
+// plainLines turns plain text into unstyled lines, one per "\n".
+func plainLines(text string) []core.Line {
+	var lines []core.Line
+	for _, s := range strings.Split(text, "\n") {
+		lines = append(lines, core.Line{{Text: s}})
+	}
+	return lines
+}
+
+// words splits a line at spaces into words that keep their styles; a word
+// may have several spans, as in "**bi**cycle".
+func words(l core.Line) []core.Line {
+	var out []core.Line
+	var cur core.Line
+	for _, sp := range l {
+		for i, part := range strings.Split(sp.Text, " ") {
+			if i > 0 && len(cur) > 0 {
+				out = append(out, cur)
+				cur = nil
+			}
+			if part != "" {
+				cur = append(cur, core.Span{Text: part, Style: sp.Style})
+			}
+		}
+	}
+	if len(cur) > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// appendLine appends b to a, merging adjacent spans of the same style.
+func appendLine(a, b core.Line) core.Line {
+	for _, sp := range b {
+		if n := len(a); n > 0 && a[n-1].Style == sp.Style {
+			a[n-1].Text += sp.Text
+		} else {
+			a = append(a, sp)
+		}
+	}
+	return a
+}
+
+// splitWord cuts a word after n runes.
+func splitWord(w core.Line, n int) (core.Line, core.Line) {
+	var head, tail core.Line
+	for _, sp := range w {
+		r := []rune(sp.Text)
+		switch {
+		case n <= 0:
+			tail = append(tail, sp)
+		case n >= len(r):
+			head = append(head, sp)
+		default:
+			head = append(head, core.Span{Text: string(r[:n]), Style: sp.Style})
+			tail = append(tail, core.Span{Text: string(r[n:]), Style: sp.Style})
+		}
+		n -= len(r)
+	}
+	return head, tail
+}
+
+// wrapLines greedily breaks styled lines into lines no wider than maxW
+// pixels. Words wider than a whole line are split between characters.
+func wrapLines(lines []core.Line, ft FontType, size, maxW int) []core.Line {
+	fits := func(l core.Line) bool { return lineWidth(l, ft, size) <= maxW }
+	var out []core.Line
+	for _, para := range lines {
+		var line core.Line
+		for _, w := range words(para) {
+			if len(line) > 0 {
+				try := appendLine(appendLine(append(core.Line(nil), line...), core.Line{{Text: " "}}), w)
+				if fits(try) {
+					line = try
+					continue
+				}
+				out = append(out, line)
+				line = nil
+			}
+			for !fits(w) && len([]rune(w.String())) > 1 {
+				n := len([]rune(w.String())) - 1
+				head, tail := splitWord(w, n)
+				for n > 1 && !fits(head) {
+					n--
+					head, tail = splitWord(w, n)
+				}
+				out = append(out, head)
+				w = tail
+			}
+			line = appendLine(nil, w)
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// textLayout is text wrapped at a font size and split into pages.
+type textLayout struct {
+	Size       int
+	LineHeight int
+	Pages      [][]core.Line
+}
+
+// layoutText wraps styled lines to w pixels, shrinking the font from size
+// towards minSize until they fit in h. Text that still doesn't fit at
+// minSize is split into pages of h pixels.
+func layoutText(lines []core.Line, ft FontType, size, minSize, w, h int) textLayout {
+	if minSize > size {
+		minSize = size
+	}
+	if minSize < 1 {
+		minSize = 1
+	}
+	for s := size; ; s-- {
+		face := fontFace(ft, s)
+		if face == nil {
+			return textLayout{Size: s, LineHeight: 1, Pages: [][]core.Line{lines}}
+		}
+		wrapped := wrapLines(lines, ft, s, w)
+		lh := face.Metrics().Height.Ceil()
+		if len(wrapped)*lh > h && s > minSize {
+			continue
+		}
+		perPage := h / lh
+		if perPage < 1 {
+			perPage = 1
+		}
+		l := textLayout{Size: s, LineHeight: lh}
+		for len(wrapped) > perPage {
+			l.Pages = append(l.Pages, wrapped[:perPage])
+			wrapped = wrapped[perPage:]
+		}
+		l.Pages = append(l.Pages, wrapped)
+		return l
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ============================================================
+// Frontlight: brightness and warmth through sysfs
+// ============================================================
+
+// frontlight says where a model's light is controlled, as files below
+// sysfsRoot. Brightness runs from 0 to the max_brightness file next to it
+// (100 if there is none).
+type frontlight struct {
+	Brightness     string
+	Warmth         string // "" = no warmth control
+	WarmthMax      int
+	WarmthInverted bool // the file counts from warm (0) to cool (max)
+}
+
+// defaultFrontlight is used for models missing from frontlights.
+var defaultFrontlight = frontlight{Brightness: "class/backlight/mxc_msp430.0/brightness"}
+
+// frontlights is keyed by Kobo device ID like deviceProfiles. None has
+// been checked on hardware yet, including the warmth file and its
+// direction on the Clara BW; frontlight_path and frontlight_warmth_path in
+// anki-fbink.conf override them. The first Elipsa's light has no warmth
+// control, so it has none here.
+var frontlights = map[int]frontlight{
+	376: {"class/backlight/mxc_msp430.0/brightness", "class/backlight/lm3630a_led/color", 10, true}, // unverified
+	377: {"class/backlight/mxc_msp430.0/brightness", "class/backlight/tlc5947_bl/color", 10, true},  // unverified
+	380: {"class/backlight/mxc_msp430.0/brightness", "class/backlight/tlc5947_bl/color", 10, true},  // unverified
+	383: {"class/backlight/mxc_msp430.0/brightness", "class/backlight/tlc5947_bl/color", 10, true},  // unverified
+	386: {"class/backlight/mxc_msp430.0/brightness", "class/leds/aw99703-bl_FL1/color", 10, true},   // unverified
+	387: {"class/backlight/mxc_msp430.0/brightness", "", 0, false},                                  // unverified
+	388: {"class/backlight/mxc_msp430.0/brightness", "class/leds/aw99703-bl_FL1/color", 10, true},   // unverified
+	389: {"class/backlight/mxc_msp430.0/brightness", "class/leds/aw99703-bl_FL1/color", 10, true},   // unverified
+	390: {"class/backlight/mxc_msp430.0/brightness", "class/leds/aw99703-bl_FL1/color", 10, true},   // unverified
+	393: {"class/backlight/mxc_msp430.0/brightness", "class/leds/aw99703-bl_FL1/color", 10, true},   // unverified
+	395: {"class/backlight/mxc_msp430.0/brightness", "class/leds/aw99703-bl_FL1/color", 10, true},   // unverified
+}
+
+const lightStep = 10 // percent per button press
+
+var (
+	light       frontlight
+	lightLevel  int    // brightness, percent
+	warmthLevel int    // warmth, percent (0 = coolest)
+	lightSaved  [2]int // levels when the light screen opened
+	lightFrom   Screen // screen to return to from the light screen
+)
+
+// initFrontlight picks the light for deviceID, then applies the levels
+// saved in the config or, without them, reads the current ones.
+func initFrontlight() {
+	var ok bool
+	if light, ok = frontlights[deviceID]; !ok {
+		light = defaultFrontlight
+	}
+	if cfg.FrontlightPath != "" {
+		light.Brightness = cfg.FrontlightPath
+	}
+	if cfg.WarmthPath == "off" {
+		light.Warmth = ""
+	} else if cfg.WarmthPath != "" {
+		light.Warmth = cfg.WarmthPath
+		if light.WarmthMax == 0 {
+			light.WarmthMax = 10
+		}
+	}
+	if !hasFrontlight() {
+		return
+	}
+
+	lightLevel = readLight()
+	if cfg.Frontlight >= 0 {
+		setLight(cfg.Frontlight)
+	}
+	if hasWarmth() {
+		warmthLevel = readWarmth()
+		if cfg.Warmth >= 0 {
+			setWarmth(cfg.Warmth)
+		}
+	}
+}
+
+// hasFrontlight reports whether the brightness file exists.
+func hasFrontlight() bool {
+	if light.Brightness == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(sysfsRoot, light.Brightness))
+	return err == nil
+}
+
+func hasWarmth() bool {
+	if light.Warmth == "" || light.WarmthMax <= 0 {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(sysfsRoot, light.Warmth))
+	return err == nil
+}
+
+// maxBrightness reads max_brightness beside the brightness file.
+func maxBrightness() int {
+	path := filepath.Join(sysfsRoot, filepath.Dir(light.Brightness), "max_brightness")
+	if v, err := strconv.Atoi(readSysfs(path)); err == nil && v > 0 {
+		return v
+	}
+	return 100
+}
+
+func readLight() int {
+	v, _ := strconv.Atoi(readSysfs(filepath.Join(sysfsRoot, light.Brightness)))
+	return min(max(v*100/maxBrightness(), 0), 100)
+}
+
+func readWarmth() int {
+	v, _ := strconv.Atoi(readSysfs(filepath.Join(sysfsRoot, light.Warmth)))
+	if light.WarmthInverted {
+		v = light.WarmthMax - v
+	}
+	return min(max(v*100/light.WarmthMax, 0), 100)
+}
+
+// setLight sets the brightness in percent.
+func setLight(pct int) {
+	lightLevel = min(max(pct, 0), 100)
+	v := lightLevel * maxBrightness() / 100
+	if err := sysfsWrite(light.Brightness, strconv.Itoa(v)); err != nil {
+		fmt.Fprintf(os.Stderr, "frontlight: %v\n", err)
+	}
+}
+
+// setWarmth sets the warmth in percent.
+func setWarmth(pct int) {
+	warmthLevel = min(max(pct, 0), 100)
+	v := (warmthLevel*light.WarmthMax + 50) / 100
+	if light.WarmthInverted {
+		v = light.WarmthMax - v
+	}
+	if err := sysfsWrite(light.Warmth, strconv.Itoa(v)); err != nil {
+		fmt.Fprintf(os.Stderr, "frontlight: %v\n", err)
+	}
+}
+
+// drawLightButton puts a Light button in the right quarter of the top row
+// r, if there is a frontlight, and returns the rest of the row.
+func drawLightButton(r Rect, gap int) Rect {
+	if !hasFrontlight() {
+		return r
+	}
+	w := (r.W - gap) / 4
+	r.W -= w + gap
+	drawButton("light", Rect{r.X + r.W + gap, r.Y, w, r.H}, "Light", FontMenu, cfg.SizeMenu/2)
+	return r
+}
+
+func openLight(from Screen) Screen {
+	lightFrom = from
+	lightSaved = [2]int{lightLevel, warmthLevel}
+	drawLightScreen()
+	return ScreenLight
+}
+
+// changeLight applies a light screen button press.
+func changeLight(id string) {
+	switch id {
+	case "light-inc":
+		setLight(lightLevel + lightStep)
+	case "light-dec":
+		setLight(lightLevel - lightStep)
+	case "light-off":
+		setLight(0)
+	case "warmth-inc":
+		setWarmth(warmthLevel + lightStep)
+	case "warmth-dec":
+		setWarmth(warmthLevel - lightStep)
+	}
+}
+
+// saveLight writes the levels to anki-fbink.conf if they changed since
+// openLight, so the next start uses them.
+func saveLight() error {
+	values := map[string]string{}
+	if lightLevel != lightSaved[0] {
+		values["frontlight"] = strconv.Itoa(lightLevel)
+	}
+	if hasWarmth() && warmthLevel != lightSaved[1] {
+		values["frontlight_warmth"] = strconv.Itoa(warmthLevel)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return updateConfigFile(configPath, values)
+}
+
+func drawLightScreen() {
+	sceneClear()
+	renderer.Clear()
+
+	gap := screenW / 30
+	drawLabel(vcenter(navRect, cfg.SizeTitle*3/4), "Frontlight", FontMenu, cfg.SizeTitle*3/4, "")
+
+	type row struct {
+		label, id string
+		value     int
+	}
+	rows := []row{{"Brightness", "light", lightLevel}}
+	if hasWarmth() {
+		rows = append(rows, row{"Warmth", "warmth", warmthLevel})
+	}
+	area := inset(Rect{contentRect.X, contentRect.Y, contentRect.W, contentRect.H / 2}, gap/2)
+	size := cfg.SizeMenu * 3 / 4
+	for i, r := range splitV(area, 3, gap/2) {
+		ctrl := Rect{r.X + r.W*2/5, r.Y, r.W * 3 / 5, r.H}
+		if i == len(rows) {
+			// Off sits under the steppers, like a toggle in settings
+			drawButton("light-off", Rect{ctrl.X + ctrl.W/3, ctrl.Y, ctrl.W * 2 / 3, ctrl.H}, "Off", FontMenu, size)
+			break
+		}
+		renderer.TextRect(vcenter(Rect{r.X + gap/2, r.Y, r.W * 2 / 5, r.H}, size), rows[i].label, FontMenu, size, "", AlignLeft)
+		cols := splitH(ctrl, 4, gap/2)
+		valueRect := Rect{cols[1].X, r.Y, cols[2].X + cols[2].W - cols[1].X, r.H}
+		drawFittedLines(vcenter(valueRect, size), plainLines(fmt.Sprintf("%d%%", rows[i].value)), FontMenu, size, "")
+		drawButton(rows[i].id+"-dec", cols[0], "-", FontMenu, size)
+		drawButton(rows[i].id+"-inc", cols[3], "+", FontMenu, size)
+	}
+
+	doneRect := splitV(inset(actionRect, gap/2), 2, gap)[1]
+	drawButton("back", doneRect, "Done", FontMenu, cfg.SizeMenu/2)
+
+	renderer.Refresh()
+	drainInput()
+}
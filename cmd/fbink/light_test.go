@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeFrontlight adds a Clara 2E style frontlight to the fake sysfs, at
+// raw brightness (of 100) and raw color (of 10, 0 = warmest), and picks it
+// up as the app would at start.
+func fakeFrontlight(t *testing.T, brightness, color int) {
+	t.Helper()
+	for rel, value := range map[string]int{
+		"class/backlight/mxc_msp430.0/brightness":     brightness,
+		"class/backlight/mxc_msp430.0/max_brightness": 100,
+		"class/leds/aw99703-bl_FL1/color":             color,
+	} {
+		path := filepath.Join(sysfsRoot, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(strconv.Itoa(value)+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := deviceID
+	t.Cleanup(func() { deviceID = saved })
+	deviceID = 386
+	initFrontlight()
+}
+
+func readFakeSysfs(t *testing.T, rel string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(sysfsRoot, rel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestInitFrontlight(t *testing.T) {
+	setupImageScreen(t)
+	saved := cfg.Frontlight
+	defer func() { cfg.Frontlight = saved }()
+
+	fakeFrontlight(t, 40, 3)
+	if lightLevel != 40 || warmthLevel != 70 {
+		t.Errorf("read brightness %d%% warmth %d%%, want 40%% and 70%%", lightLevel, warmthLevel)
+	}
+
+	cfg.Frontlight = 25
+	fakeFrontlight(t, 40, 3)
+	if got := readFakeSysfs(t, "class/backlight/mxc_msp430.0/brightness"); got != "25" {
+		t.Errorf("brightness %s after start, want the configured 25", got)
+	}
+
+	// frontlight_warmth_path=off turns the warmth control off.
+	savedPath := cfg.WarmthPath
+	defer func() { cfg.WarmthPath = savedPath }()
+	cfg.WarmthPath = "off"
+	fakeFrontlight(t, 40, 3)
+	if !hasFrontlight() || hasWarmth() {
+		t.Errorf("warmth off: hasFrontlight %v hasWarmth %v, want true false", hasFrontlight(), hasWarmth())
+	}
+	if got := readFakeSysfs(t, "class/leds/aw99703-bl_FL1/color"); got != "3" {
+		t.Errorf("warmth %s after start with warmth off, want it left at 3", got)
+	}
+	cfg.WarmthPath = ""
+
+	// Without a warmth file only brightness is offered.
+	os.Remove(filepath.Join(sysfsRoot, "class/leds/aw99703-bl_FL1/color"))
+	if !hasFrontlight() || hasWarmth() {
+		t.Errorf("hasFrontlight %v hasWarmth %v, want true false", hasFrontlight(), hasWarmth())
+	}
+}
+
+// TestLightScreen opens the light screen from a card, changes both levels
+// and checks they reach sysfs and the config.
+func TestLightScreen(t *testing.T) {
+	setupImageScreen(t)
+	fakeFrontlight(t, 40, 3)
+	defer func() { input = nil; configPath = "./anki-fbink.conf" }()
+	configPath = filepath.Join(t.TempDir(), "anki-fbink.conf")
+	os.WriteFile(configPath, []byte("# light\nfrontlight=40\n"), 0644)
+
+	drawLightScreen()
+	warmer := sceneCenter(t, "warmth-dec")
+	input = newStdinInput(strings.NewReader("1\nl\nnext\nnext\n" + warmer + "\nenter\nenter\n3\nback\nq\n"))
+	run()
+
+	if got := readFakeSysfs(t, "class/backlight/mxc_msp430.0/brightness"); got != "60" {
+		t.Errorf("brightness %s, want 60", got)
+	}
+	if got := readFakeSysfs(t, "class/leds/aw99703-bl_FL1/color"); got != "4" {
+		t.Errorf("color %s, want 4 (warmth 60%%)", got)
+	}
+	data, _ := os.ReadFile(configPath)
+	if want := "# light\nfrontlight=60\nfrontlight_warmth=60\n"; string(data) != want {
+		t.Errorf("config:\n%s\nwant:\n%s", data, want)
+	}
+	// Back on the front screen, so the card was shown and rated.
+	if n := reviewedCount(t); n != 1 {
+		t.Errorf("reviewed %d cards, want 1", n)
+	}
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"encoding/binary"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"kobo-anki/core"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -106,122 +112,121 @@ func vcenter(r Rect, size int) Rect {
 }
 
 // ============================================================
-// FBInk primitives
+// Widgets
 // ============================================================
 
-// fbinkFillRect fills a rectangle with a color (no screen refresh).
-func fbinkFillRect(r Rect, color string) {
-	region := fmt.Sprintf("top=%d,left=%d,width=%d,height=%d", r.Y, r.X, r.W, r.H)
-	args := []string{"-k", region, "-b"}
-	if color != "" {
-		args = append(args, "-B", color)
-	}
-	if cfg.DarkMode {
-		args = append(args, "-H")
-	}
-	exec.Command(fbinkPath, args...).Run()
-}
-
-// fbinkTextRect draws text inside a rect (bgless overlay, no refresh).
-func fbinkTextRect(r Rect, text string, font FontType, size int, color string, align Align) {
-	fontPath := resolveFont(font)
-	if fontPath == "" {
-		// Fallback to bitmap font
-		row := r.Y * 20 / screenH
-		args := []string{"-y", strconv.Itoa(row), "-S", strconv.Itoa(size / 8), "-O", "-b"}
-		if align == AlignCenter {
-			args = append(args, "-m")
-		}
-		if color != "" {
-			args = append(args, "-C", color)
-		}
-		if cfg.DarkMode {
-			args = append(args, "-H")
-		}
-		args = append(args, text)
-		if debug {
-			fmt.Printf("fbink: %v\n", args)
-		}
-		cmd := exec.Command(fbinkPath, args...)
-		out, err := cmd.CombinedOutput()
-		if err != nil && debug {
-			fmt.Printf("fbink error: %v, output: %s\n", err, string(out))
-		}
-		return
-	}
-
-	left := r.X
-	right := screenW - (r.X + r.W)
-	if right < 0 {
-		right = 0
-	}
-
-	// For right-align: push left margin so text hugs the right edge
-	if align == AlignRight {
-		left = r.X + r.W*2/3
-	}
-
-	tt := fmt.Sprintf("regular=%s,size=%d,top=%d,left=%d,right=%d",
-		fontPath, size, r.Y, left, right)
-
-	args := []string{"-t", tt, "-O", "-b"}
-	if align == AlignCenter {
-		args = append(args, "-m")
-	}
-	if color != "" {
-		args = append(args, "-C", color)
-	}
-	if cfg.DarkMode {
-		args = append(args, "-H")
-	}
-	args = append(args, text)
-
-	if debug {
-		fmt.Printf("fbink: %v\n", args)
-	}
-	cmd := exec.Command(fbinkPath, args...)
-	out, err := cmd.CombinedOutput()
-	if err != nil && debug {
-		fmt.Printf("fbink error: %v, output: %s\n", err, string(out))
-	}
-}
-
 // drawButton draws a filled button and registers it as a touch target.
 func drawButton(id string, r Rect, label string, font FontType, size int) {
 	sceneAdd(id, r)
-	fbinkFillRect(r, "GRAYD")
-	fbinkTextRect(vcenter(r, size), label, font, size, "", AlignCenter)
+	renderer.FillRect(r, "GRAYD")
+	renderer.TextRect(vcenter(r, size), label, font, size, "", AlignCenter)
 }
 
 // drawButtonDisabled draws a button with no touch target (grayed out).
 func drawButtonDisabled(r Rect, label string, font FontType, size int) {
-	fbinkFillRect(r, "GRAYE")
-	fbinkTextRect(vcenter(r, size), label, font, size, "GRAYB", AlignCenter)
+	renderer.FillRect(r, "GRAYE")
+	renderer.TextRect(vcenter(r, size), label, font, size, "GRAYB", AlignCenter)
 }
 
 // drawLabel draws centered text in a rect (no border, no touch target).
 func drawLabel(r Rect, text string, font FontType, size int, color string) {
-	fbinkTextRect(r, text, font, size, color, AlignCenter)
+	renderer.TextRect(r, text, font, size, color, AlignCenter)
+}
+
+// drawFittedLabel draws card text in r like drawLabel, without markup, but
+// wraps it and shrinks it down to two thirds of size to fit; anything left
+// over is cut off with an ellipsis.
+func drawFittedLabel(r Rect, text string, font FontType, size int, color string) {
+	drawFittedLines(r, plainLines(core.PlainText(text)), font, size, color)
 }
 
-func fbinkClear() {
-	args := []string{"-c"}
-	if cfg.DarkMode {
-		args = append(args, "-H")
+// drawFittedLines is drawFittedLabel for text that is already lines.
+func drawFittedLines(r Rect, lines []core.Line, font FontType, size int, color string) {
+	l := layoutText(lines, font, size, size*2/3, r.W, r.H)
+	page := l.Pages[0]
+	if len(l.Pages) > 1 {
+		page = append([]core.Line(nil), page...)
+		page[len(page)-1] = appendLine(append(core.Line(nil), page[len(page)-1]...), core.Line{{Text: "…"}})
 	}
-	exec.Command(fbinkPath, args...).Run()
+	renderer.StyledText(r, page, font, l.Size, color, AlignCenter)
 }
 
-func fbinkRefresh() {
-	exec.Command(fbinkPath, "-s").Run()
+// drawCardText draws a card side, with its markup, in area, vertically centered on centerIn
+// if it fits there, so short text sits at the same height on the front and
+// back screens, and at the top of area otherwise. Long text wraps and shrinks down to size_min;
+// if it still doesn't fit it is paged, with page buttons at the bottom of
+// area and cardPage selecting the page. Images go side by side above the
+// text, taking half of area, or all of it on an image-only side.
+func drawCardText(area, centerIn Rect, text string, font FontType) {
+	pad := screenW / 20
+	if imgs := cardImages(text); len(imgs) > 0 {
+		imgH := area.H
+		if core.PlainText(text) != "" {
+			imgH = area.H / 2
+		}
+		row := Rect{area.X + pad, area.Y + pad/2, area.W - 2*pad, imgH - pad}
+		for i, r := range splitH(row, len(imgs), pad) {
+			renderer.Image(r, imgs[i])
+		}
+		area = Rect{area.X, area.Y + imgH, area.W, area.H - imgH}
+		centerIn = area
+	}
+	w := area.W - 2*pad
+	textArea := area
+	rich := core.ParseRich(text)
+	l := layoutText(rich, font, cfg.SizeCard, cfg.SizeMin, w, textArea.H)
+	if len(l.Pages) > 1 {
+		gap := screenW / 30
+		navH := screenH * 6 / 100
+		textArea.H -= navH
+		l = layoutText(rich, font, cfg.SizeCard, cfg.SizeMin, w, textArea.H)
+		if cardPage >= len(l.Pages) {
+			cardPage = len(l.Pages) - 1
+		}
+
+		nav := inset(Rect{area.X, area.Y + area.H - navH, area.W, navH}, gap/2)
+		cols := splitH(nav, 3, gap)
+		if cardPage > 0 {
+			drawButton("page-prev", cols[0], "<", FontMenu, cfg.SizeMenu/2)
+		} else {
+			drawButtonDisabled(cols[0], "<", FontMenu, cfg.SizeMenu/2)
+		}
+		drawLabel(vcenter(cols[1], cfg.SizeMenu/2), fmt.Sprintf("%d / %d", cardPage+1, len(l.Pages)), FontMenu, cfg.SizeMenu/2, "GRAY8")
+		if cardPage < len(l.Pages)-1 {
+			drawButton("page-next", cols[2], ">", FontMenu, cfg.SizeMenu/2)
+		} else {
+			drawButtonDisabled(cols[2], ">", FontMenu, cfg.SizeMenu/2)
+		}
+	} else {
+		cardPage = 0
+	}
+
+	lines := l.Pages[cardPage]
+	blockH := len(lines) * l.LineHeight
+	y := centerIn.Y + (centerIn.H-blockH)/2
+	if y < textArea.Y || y+blockH > textArea.Y+textArea.H {
+		y = textArea.Y
+	}
+	r := Rect{area.X + pad, y, w, textArea.Y + textArea.H - y}
+	renderer.StyledText(r, lines, font, l.Size, "", AlignCenter)
+}
+
+// cardImages returns the paths of the images a card side references that
+// are present in the media folder.
+func cardImages(text string) []string {
+	var paths []string
+	for _, name := range core.Images(text) {
+		if p, err := core.MediaPath(dataDir, name); err == nil && fileExists(p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
 }
 
 // ============================================================
 // Types & globals
 // ============================================================
 
-type TouchEvent struct{ X, Y int }
-
 type Screen int
 
 const (
@@ -229,6 +234,10 @@ const (
 	ScreenFront
 	ScreenBack
 	ScreenDone
+	ScreenActions
+	ScreenSettings
+	ScreenStats
+	ScreenLight
 )
 
 type FontType int
@@ -245,25 +254,33 @@ var (
 	cards       []core.Card
 	csvFile     string
 	dataDir     = "."
-	currentDeck string
+	currentDeck core.DeckName
 	currentCard *core.Card
-	decks       []string
+	decks       []core.DeckName
+	session     core.Session // counts for the done screen
 
 	deckPage     int
 	decksPerPage int
 
-	touchMaxX = 1440
-	touchMaxY = 1020
+	// Clara BW defaults until applyDeviceProfile runs
+	touch     = touchGeometry{MaxX: 1440, MaxY: 1020, SwapXY: true, MirrorX: true}
 	screenW   = 1072
 	screenH   = 1448
+	screenDPI = 300
 
 	reverseMode = false
+	cardPage    int // page of the card side on screen, for long text
+
+	actionsFrom   Screen // screen to return to from card actions
+	confirmDelete bool
 
 	touchDevice   = "/dev/input/event1"
 	fbinkPath     = "fbink"
 	touchFd       int // raw syscall fd — bypasses Go runtime poller
+	touchSource   evdevSource
 	debug         = false
 	lastTouchTime time.Time
+	clock         = time.Now // replaced by replay so cooldowns follow recorded time
 	touchCooldown = 300 * time.Millisecond
 
 	cfg = struct {
@@ -274,11 +291,61 @@ var (
 		SizeTitle int
 		SizeCard  int
 		SizeMenu  int
+		SizeMin   int // smallest size card text shrinks to before paging
 		DarkMode  bool
+		Renderer  string // "fbink" (default), "batch" or "image"
+		ImageDir  string // image renderer: where to write frame PNGs
+		Input     string // "touch" (default), "stdin" or "none"
+		Keyboard  string // "off" (default), "auto" or an evdev path
+		PageKeys  string // page-turn buttons: "auto" (default), "off" or a path
+		PowerKey  string // power button, for suspend: "auto" (default), "off" or a path
+		// AudioPlayer is the command [sound:...] files are passed to, e.g.
+		// "mpg123 -q"; "" = no sound.
+		AudioPlayer string
+
+		// Style variants of the card fonts; "" = Name-Bold.ttf etc. next
+		// to the regular file, if present.
+		FontBold       string
+		FontItalic     string
+		FontBoldItalic string
+
+		Device       int // Kobo device ID; 0 = detect
+		TouchMaxX    int // raw touch ranges; 0 = from profile or device
+		TouchMaxY    int
+		TouchSwapXY  *bool // nil = from profile
+		TouchMirrorX *bool
+		TouchMirrorY *bool
+
+		ButtonLayout string // rating buttons: "grid" (default), "row" or "passfail"
+		LeftHanded   bool   // mirror the rating buttons left to right
+		LayoutNav    int    // height of the top region, percent of the screen
+		LayoutAction int    // height of the button region, percent of the screen
+
+		// Keys holds per-screen key bindings changed by keys_<screen>
+		// settings; screens without an entry use defaultKeys.
+		Keys map[Screen]map[string]string
+
+		StatusBar  bool // clock and battery under the top buttons
+		LowBattery int  // percent at which the app saves and exits; 0 = never
+
+		Frontlight     int    // brightness at start, percent; -1 = leave as is
+		Warmth         int    // warmth at start, percent; -1 = leave as is
+		FrontlightPath string // brightness file below sysfs_root; "" = by model
+		WarmthPath     string // warmth file below sysfs_root; "" = by model, "off" = no warmth control
 	}{
-		SizeTitle: 24,
-		SizeCard:  28,
-		SizeMenu:  16,
+		SizeTitle:    24,
+		SizeCard:     28,
+		SizeMenu:     16,
+		SizeMin:      12,
+		PageKeys:     "auto",
+		PowerKey:     "auto",
+		ButtonLayout: layoutGrid,
+		LayoutNav:    8,
+		LayoutAction: 22,
+		StatusBar:    true,
+		LowBattery:   5,
+		Frontlight:   -1,
+		Warmth:       -1,
 	}
 )
 
@@ -290,21 +357,44 @@ var (
 )
 
 func computeLayout() {
-	navRect = rectPct(0, 0, 100, 8)
-	contentRect = rectPct(0, 8, 100, 70)
-	actionRect = rectPct(0, 78, 100, 22)
+	nav, action := cfg.LayoutNav, cfg.LayoutAction
+	if nav < 0 || action < 10 || nav+action > 60 {
+		// Leave the card at least 40% of the screen
+		nav, action = 8, 22
+	}
+	navRect = rectPct(0, 0, 100, nav)
+	contentRect = rectPct(0, nav, 100, 100-nav-action)
+	actionRect = rectPct(0, 100-action, 100, action)
+}
+
+// backButtonH is the height of the Back button row: half a rating button
+// row in the default layout, whatever layout_action is set to.
+func backButtonH(gap int) int {
+	return (screenH*22/100 - 2*gap) / 4
 }
 
 // ============================================================
 // Config
 // ============================================================
 
+// configPath is the anki-fbink.conf that was loaded, and where settings
+// changed on the device are written back.
+var configPath = "./anki-fbink.conf"
+
+// coreConfigPath is the shared anki-core.conf; coreCfg holds what was read
+// from it, as changed on the settings screen.
+var (
+	coreConfigPath = "anki-core.conf"
+	coreCfg        core.CoreConfig
+)
+
 func loadConfig() {
 	paths := []string{"./anki-fbink.conf", filepath.Join(dataDir, "anki-fbink.conf")}
 	var data []byte
 	for _, p := range paths {
 		var err error
 		if data, err = os.ReadFile(p); err == nil {
+			configPath = p
 			break
 		}
 	}
@@ -331,6 +421,12 @@ func loadConfig() {
 			cfg.FontBack = value
 		case "font_menu":
 			cfg.FontMenu = value
+		case "font_bold":
+			cfg.FontBold = value
+		case "font_italic":
+			cfg.FontItalic = value
+		case "font_bold_italic":
+			cfg.FontBoldItalic = value
 		case "size_title":
 			if v, err := strconv.Atoi(value); err == nil {
 				cfg.SizeTitle = v
@@ -343,12 +439,102 @@ func loadConfig() {
 			if v, err := strconv.Atoi(value); err == nil {
 				cfg.SizeMenu = v
 			}
+		case "size_min":
+			if v, err := strconv.Atoi(value); err == nil {
+				cfg.SizeMin = v
+			}
+		case "renderer":
+			cfg.Renderer = value
+		case "audio_player":
+			cfg.AudioPlayer = value
+		case "image_dir":
+			cfg.ImageDir = value
+		case "input":
+			cfg.Input = value
+		case "keyboard":
+			cfg.Keyboard = value
+		case "page_keys":
+			cfg.PageKeys = value
+		case "power_key":
+			cfg.PowerKey = value
 		case "darkmode":
 			cfg.DarkMode = value == "true" || value == "1"
+		case "button_layout":
+			switch value {
+			case layoutGrid, layoutRow, layoutPassFail:
+				cfg.ButtonLayout = value
+			}
+		case "status_bar":
+			cfg.StatusBar = value == "true" || value == "1"
+		case "low_battery":
+			if v, err := strconv.Atoi(value); err == nil {
+				cfg.LowBattery = v
+			}
+		case "sysfs_root":
+			sysfsRoot = value
+		case "frontlight":
+			if v, err := strconv.Atoi(value); err == nil {
+				cfg.Frontlight = v
+			}
+		case "frontlight_warmth":
+			if v, err := strconv.Atoi(value); err == nil {
+				cfg.Warmth = v
+			}
+		case "frontlight_path":
+			cfg.FrontlightPath = value
+		case "frontlight_warmth_path":
+			cfg.WarmthPath = value
+		case "left_handed":
+			cfg.LeftHanded = value == "true" || value == "1"
+		case "layout_nav":
+			if v, err := strconv.Atoi(value); err == nil {
+				cfg.LayoutNav = v
+			}
+		case "layout_action":
+			if v, err := strconv.Atoi(value); err == nil {
+				cfg.LayoutAction = v
+			}
+		case "device":
+			if v, err := strconv.Atoi(value); err == nil {
+				cfg.Device = v
+			}
+		case "touch_max_x":
+			if v, err := strconv.Atoi(value); err == nil {
+				cfg.TouchMaxX = v
+			}
+		case "touch_max_y":
+			if v, err := strconv.Atoi(value); err == nil {
+				cfg.TouchMaxY = v
+			}
+		case "touch_swap_xy":
+			cfg.TouchSwapXY = parseFlag(value)
+		case "touch_mirror_x":
+			cfg.TouchMirrorX = parseFlag(value)
+		case "touch_mirror_y":
+			cfg.TouchMirrorY = parseFlag(value)
 		case "touch_cooldown":
 			if v, err := strconv.Atoi(value); err == nil {
 				touchCooldown = time.Duration(v) * time.Millisecond
 			}
+		case "swipe_distance":
+			if v, err := strconv.Atoi(value); err == nil {
+				swipeDistance = v
+			}
+		case "long_press_time":
+			if v, err := strconv.Atoi(value); err == nil {
+				longPressTime = time.Duration(v) * time.Millisecond
+			}
+		default:
+			if name, ok := strings.CutPrefix(key, "gesture_"); ok {
+				if _, known := gestureActions[name]; known {
+					gestureActions[name] = value
+				}
+			}
+			if name, ok := strings.CutPrefix(key, "keys_"); ok {
+				if screen, known := screenNames[name]; known {
+					setScreenKeys(screen, value)
+				}
+			}
 		}
 	}
 
@@ -357,6 +543,67 @@ func loadConfig() {
 	}
 }
 
+// updateConfigFile sets key=value lines in a config file, keeping comments
+// and everything else as it was. Existing lines for a key are rewritten in
+// place; failing that, a commented-out "#key=" line is uncommented; other
+// keys are appended.
+func updateConfigFile(path string, values map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+
+	done := map[string]bool{}
+	set := func(commented bool) {
+		for i, line := range lines {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "#") != commented {
+				continue
+			}
+			key, _, ok := strings.Cut(strings.TrimPrefix(line, "#"), "=")
+			key = strings.TrimSpace(key)
+			v, want := values[key]
+			if !ok || !want || (commented && done[key]) {
+				continue
+			}
+			lines[i] = key + "=" + v
+			done[key] = true
+		}
+	}
+	set(false)
+	set(true)
+
+	var rest []string
+	for k := range values {
+		if !done[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	for _, k := range rest {
+		lines = append(lines, k+"="+values[k])
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// parseFlag parses a boolean config value; "" leaves the setting unset.
+func parseFlag(value string) *bool {
+	if value == "" {
+		return nil
+	}
+	b := value == "true" || value == "1"
+	return &b
+}
+
 func resolveFont(ft FontType) string {
 	if cfg.FontDir == "" {
 		return ""
@@ -392,30 +639,27 @@ func findFbink() string {
 	return "fbink"
 }
 
-func detectScreen() {
+// detectScreen asks FBInk for the panel size and DPI, and returns its
+// device ID and whether the size was found.
+func detectScreen() (deviceID int, ok bool) {
 	out, err := exec.Command(fbinkPath, "-e").Output()
 	if err != nil {
-		return
+		return 0, false
 	}
-	for _, line := range strings.Split(string(out), "\n") {
-		if strings.Contains(line, "viewWidth") {
-			if parts := strings.Split(line, ":"); len(parts) >= 2 {
-				if w, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil {
-					screenW = w
-				}
-			}
-		}
-		if strings.Contains(line, "viewHeight") {
-			if parts := strings.Split(line, ":"); len(parts) >= 2 {
-				if h, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil {
-					screenH = h
-				}
-			}
-		}
+	st := parseFbinkState(string(out))
+	w, errW := strconv.Atoi(st["viewWidth"])
+	h, errH := strconv.Atoi(st["viewHeight"])
+	if errW == nil && errH == nil && w > 0 && h > 0 {
+		screenW, screenH, ok = w, h, true
+	}
+	if dpi, err := strconv.Atoi(st["screenDPI"]); err == nil && dpi > 0 {
+		screenDPI = dpi
 	}
+	deviceID, _ = strconv.Atoi(st["deviceId"])
 	if debug {
-		fmt.Printf("Detected screen: %dx%d\n", screenW, screenH)
+		fmt.Printf("Detected screen: %dx%d, device %d\n", screenW, screenH, deviceID)
 	}
+	return deviceID, ok
 }
 
 // ============================================================
@@ -454,6 +698,70 @@ func findTouchDevice() string {
 	return "/dev/input/event1"
 }
 
+// evdevEvent is one evdev struct input_event.
+type evdevEvent struct {
+	Time  time.Time
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// evdevSource yields raw input events. The touchscreen fd, the recorder and
+// replay files all implement it, so they share parsing and hit-testing.
+type evdevSource interface {
+	ReadEvent() (evdevEvent, error)
+	// Drain discards queued events (taps made while the screen redrew).
+	Drain()
+}
+
+// evdevEventSize is sizeof(struct input_event): a native timeval followed
+// by type, code and value. 16 bytes on the Kobo's 32-bit ARM.
+var evdevEventSize = int(unsafe.Sizeof(syscall.Timeval{})) + 8
+
+func parseEvdevEvent(buf []byte) evdevEvent {
+	le := binary.LittleEndian
+	var sec, usec int64
+	if len(buf) >= 24 {
+		sec, usec = int64(le.Uint64(buf[0:8])), int64(le.Uint64(buf[8:16]))
+	} else {
+		sec, usec = int64(int32(le.Uint32(buf[0:4]))), int64(int32(le.Uint32(buf[4:8])))
+	}
+	o := len(buf) - 8
+	return evdevEvent{
+		Time:  time.Unix(sec, usec*1000),
+		Type:  le.Uint16(buf[o : o+2]),
+		Code:  le.Uint16(buf[o+2 : o+4]),
+		Value: int32(le.Uint32(buf[o+4 : o+8])),
+	}
+}
+
+// fdSource reads events from an evdev file descriptor.
+type fdSource struct{ fd int }
+
+func (s fdSource) ReadEvent() (evdevEvent, error) {
+	buf := make([]byte, evdevEventSize)
+	n, err := syscall.Read(s.fd, buf)
+	if err != nil {
+		return evdevEvent{}, err
+	}
+	if n < evdevEventSize {
+		return evdevEvent{}, io.ErrUnexpectedEOF
+	}
+	return parseEvdevEvent(buf), nil
+}
+
+func (s fdSource) Drain() {
+	syscall.SetNonblock(s.fd, true)
+	buf := make([]byte, evdevEventSize)
+	for {
+		_, err := syscall.Read(s.fd, buf)
+		if err != nil {
+			break
+		}
+	}
+	syscall.SetNonblock(s.fd, false)
+}
+
 func grabTouchDevice() error {
 	touchDevice = findTouchDevice()
 
@@ -463,10 +771,26 @@ func grabTouchDevice() error {
 	}
 	touchFd = fd
 
-	one := 1
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(touchFd), EVIOCGRAB, uintptr(unsafe.Pointer(&one)))
-	if errno != 0 {
+	if err := setTouchGrab(true); err != nil {
 		syscall.Close(touchFd)
+		return err
+	}
+	touchSource = fdSource{touchFd}
+	return nil
+}
+
+// setTouchGrab takes or gives up exclusive access to the open touch
+// device, e.g. around a suspend.
+func setTouchGrab(on bool) error {
+	if touchFd <= 0 {
+		return nil
+	}
+	v := 0
+	if on {
+		v = 1
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(touchFd), EVIOCGRAB, uintptr(unsafe.Pointer(&v)))
+	if errno != 0 {
 		return fmt.Errorf("failed to grab touch device: %v", errno)
 	}
 	return nil
@@ -474,68 +798,41 @@ func grabTouchDevice() error {
 
 func releaseTouchDevice() {
 	if touchFd > 0 {
-		zero := 0
-		syscall.Syscall(syscall.SYS_IOCTL, uintptr(touchFd), EVIOCGRAB, uintptr(unsafe.Pointer(&zero)))
+		setTouchGrab(false)
 		syscall.Close(touchFd)
 	}
 }
 
-// Clara BW with rotation 3: axes are swapped
+// transformTouch maps raw panel coordinates to screen pixels using the
+// device profile's geometry.
 func transformTouch(rawX, rawY int) (int, int) {
-	return (touchMaxY - rawY) * screenW / touchMaxY, rawX * screenH / touchMaxX
+	return touch.apply(rawX, rawY, screenW, screenH)
 }
 
 func drainTouch() {
-	if touchFd <= 0 {
+	if touchSource == nil {
 		return
 	}
-	syscall.SetNonblock(touchFd, true)
-	buf := make([]byte, 16)
-	for {
-		_, err := syscall.Read(touchFd, buf)
-		if err != nil {
-			break
-		}
-	}
-	syscall.SetNonblock(touchFd, false)
-	lastTouchTime = time.Now()
+	touchSource.Drain()
+	// Whether the panel reports contact outlasts the touch being dropped.
+	gesture = gestureTracker{signaled: gesture.signaled}
+	lastTouchTime = clock()
 }
 
-func readTouch() (TouchEvent, bool) {
-	if touchFd <= 0 {
-		return TouchEvent{}, false
+// readTouch returns the next tap, swipe or long-press, recognized when the
+// finger lifts. io.EOF means there is no more input (no touch device, or
+// the end of a replay).
+func readTouch() (Event, error) {
+	if touchSource == nil {
+		return Event{}, io.EOF
 	}
-
-	var x, y int
-	var hasX, hasY bool
-
-	buf := make([]byte, 16)
 	for {
-		n, err := syscall.Read(touchFd, buf)
-		if err != nil || n < 16 {
-			return TouchEvent{}, false
-		}
-
-		typ := binary.LittleEndian.Uint16(buf[8:10])
-		code := binary.LittleEndian.Uint16(buf[10:12])
-		value := int32(binary.LittleEndian.Uint32(buf[12:16]))
-
-		if typ == 3 { // EV_ABS
-			if code == 0 || code == 53 { // ABS_X or ABS_MT_POSITION_X
-				x = int(value)
-				hasX = true
-			} else if code == 1 || code == 54 { // ABS_Y or ABS_MT_POSITION_Y
-				y = int(value)
-				hasY = true
-			}
+		ev, err := touchSource.ReadEvent()
+		if err != nil {
+			return Event{}, err
 		}
-
-		if typ == 0 && code == 0 && hasX && hasY { // SYN_REPORT
-			if debug {
-				fmt.Printf("Raw: x=%d y=%d\n", x, y)
-			}
-			tx, ty := transformTouch(x, y)
-			return TouchEvent{X: tx, Y: ty}, true
+		if g, ok := gesture.feed(ev); ok {
+			return g, nil
 		}
 	}
 }
@@ -568,13 +865,21 @@ func displayBack() string {
 
 func drawDecksScreen() {
 	sceneClear()
-	fbinkClear()
+	renderer.Clear()
 
 	// Title (with top margin)
 	topMargin := screenH * 5 / 100
 	titleRect := Rect{navRect.X, topMargin, navRect.W, navRect.H + screenH*8/100}
 	drawLabel(titleRect, "Kobo Anki", FontMenu, cfg.SizeTitle, "")
 
+	// Settings button in the top right corner, sized like the Back button
+	gap := screenW / 30
+	setW, setH := screenW/4, backButtonH(gap)
+	drawButton("settings", Rect{screenW - gap/2 - setW, gap / 2, setW, setH}, "Settings", FontMenu, cfg.SizeMenu/2)
+	if hasFrontlight() {
+		drawButton("light", Rect{gap / 2, gap / 2, setW, setH}, "Light", FontMenu, cfg.SizeMenu/2)
+	}
+
 	// Deck list area: below title, above action
 	deckAreaTop := titleRect.Y + titleRect.H
 	deckAreaH := actionRect.Y - deckAreaTop
@@ -614,16 +919,20 @@ func drawDecksScreen() {
 		due := core.CountDueCards(c)
 
 		// Deck name on the left, due count in gray on the right
-		nameRect := Rect{r.X + screenW/20, r.Y, r.W/2, r.H}
-		fbinkTextRect(vcenter(nameRect, cfg.SizeMenu*3/4), d, FontMenu, cfg.SizeMenu*3/4, "", AlignLeft)
+		nameRect := Rect{r.X + screenW/20, r.Y, r.W / 2, r.H}
+		renderer.TextRect(vcenter(nameRect, cfg.SizeMenu*3/4), string(d), FontMenu, cfg.SizeMenu*3/4, "", AlignLeft)
 
-		dueRect := Rect{r.X, r.Y, r.W - screenW/20, r.H}
+		// Stats button at the far right of the row
+		statsW := screenW / 8
+		statsRect := inset(Rect{r.X + r.W - gap/2 - statsW, r.Y, statsW, r.H}, gap/4)
+		drawButton(fmt.Sprintf("stats-%d", start+i), statsRect, "i", FontMenu, cfg.SizeMenu/2)
+
+		dueRect := Rect{r.X, r.Y, statsRect.X - gap - r.X, r.H}
 		dueText := fmt.Sprintf("%d due", due)
-		fbinkTextRect(vcenter(dueRect, cfg.SizeMenu*3/4), dueText, FontMenu, cfg.SizeMenu*3/4, "GRAY8", AlignRight)
+		renderer.TextRect(vcenter(dueRect, cfg.SizeMenu*3/4), dueText, FontMenu, cfg.SizeMenu*3/4, "GRAY8", AlignRight)
 	}
 
 	// Action zone: 2x2 grid — prev/next on top row, reverse/exit on bottom row
-	gap := screenW / 30
 	actionInner := inset(actionRect, gap/2)
 	rows := splitV(actionInner, 2, gap)
 	topCols := splitH(rows[0], 2, gap)
@@ -652,102 +961,182 @@ func drawDecksScreen() {
 	drawButton("reverse", botCols[0], reverseLabel, FontMenu, cfg.SizeMenu/2)
 	drawButton("exit", botCols[1], "Quit", FontMenu, cfg.SizeMenu/2)
 
-	fbinkRefresh()
-	drainTouch()
+	drawStatusBar()
+	renderer.Refresh()
+	drainInput()
 }
 
 func drawFrontScreen() {
 	sceneClear()
 	// Fill screen without refresh (avoids flash between back→front)
-	fbinkFillRect(Rect{0, 0, screenW, screenH}, "WHITE")
+	renderer.FillRect(Rect{0, 0, screenW, screenH}, "WHITE")
 
 	// Back button: full width, half the height of a rating button
 	gap := screenW / 30
-	btnH := (actionRect.H - 2*gap) / 4 // half of a rating button row
-	backRect := Rect{gap / 2, gap / 2, screenW - gap, btnH}
+	btnH := backButtonH(gap)
+	backRect := drawLightButton(Rect{gap / 2, gap / 2, screenW - gap, btnH}, gap)
 	drawButton("back", backRect, "Back", FontMenu, cfg.SizeMenu/2)
 
-	// Card front text — centered in content area (matches answer position on back)
-	drawLabel(vcenter(contentRect, cfg.SizeCard), displayFront(), FontFront, cfg.SizeCard, "")
-
-	// Any tap on content or action area shows answer
+	// Any tap on content or action area shows answer (page buttons,
+	// added later, take precedence)
 	sceneAdd("show", contentRect)
 	sceneAdd("show", actionRect)
 
-	fbinkRefresh()
-	drainTouch()
+	// Card front text — centered in content area (matches answer position on back)
+	drawCardText(contentRect, contentRect, displayFront(), FontFront)
+	// Gesture-only target (empty rect): long-press opens card actions
+	sceneAdd("actions", Rect{})
+
+	drawStatusBar()
+	renderer.Refresh()
+	drainInput()
 }
 
 func drawBackScreen() {
 	sceneClear()
 	// Fill screen without refresh (avoids flash between front→back)
-	fbinkFillRect(Rect{0, 0, screenW, screenH}, "WHITE")
+	renderer.FillRect(Rect{0, 0, screenW, screenH}, "WHITE")
 
 	// Back button: full width, half the height of a rating button
 	gap := screenW / 30
-	btnH := (actionRect.H - 2*gap) / 4
+	btnH := backButtonH(gap)
 	backRect := Rect{gap / 2, gap / 2, screenW - gap, btnH}
+	playW := (backRect.W - gap) / 4
+	backRect = drawLightButton(backRect, gap)
+	if len(cardSounds()) > 0 {
+		// Play button takes the quarter left of Light, or the right one
+		backRect.W -= playW + gap
+		drawButton("play", Rect{backRect.X + backRect.W + gap, backRect.Y, playW, btnH}, "Play", FontMenu, cfg.SizeMenu/2)
+	}
 	drawButton("back", backRect, "Back", FontMenu, cfg.SizeMenu/2)
 
 	// Front text (small, gray, below back button with margin)
 	frontTop := backRect.Y + backRect.H + gap
 	frontRect := Rect{contentRect.X, frontTop, contentRect.W, contentRect.H/3 - gap}
-	drawLabel(frontRect, displayFront(), FontFront, cfg.SizeMenu, "GRAY8")
+	drawFittedLabel(frontRect, displayFront(), FontFront, cfg.SizeMenu, "GRAY8")
 
-	// Answer text — centered in content area (matches front position)
-	drawLabel(vcenter(contentRect, cfg.SizeCard), displayBack(), FontBack, cfg.SizeCard, "")
+	// Answer text — centered in content area (matches front position),
+	// but kept below the front text when long
+	answerTop := frontRect.Y + frontRect.H
+	answerArea := Rect{contentRect.X, answerTop, contentRect.W, contentRect.Y + contentRect.H - answerTop}
+	drawCardText(answerArea, contentRect, displayBack(), FontBack)
 
-	// Rating buttons: 2x2 grid in action zone
-	actionInner := inset(actionRect, gap/2)
-	rows := splitV(actionInner, 2, gap)
-	topCols := splitH(rows[0], 2, gap)
-	botCols := splitH(rows[1], 2, gap)
-
-	drawButton("hard", topCols[0], "Hard", FontMenu, cfg.SizeMenu/2)
-	drawButton("good", topCols[1], "Good", FontMenu, cfg.SizeMenu/2)
-	drawButton("again", botCols[0], "Again", FontMenu, cfg.SizeMenu/2)
-	drawButton("easy", botCols[1], "Easy", FontMenu, cfg.SizeMenu/2)
+	// Rating buttons in the action zone, as configured
+	drawRatingButtons(inset(actionRect, gap/2), gap)
+	sceneAdd("actions", Rect{})
 
-	fbinkRefresh()
-	drainTouch()
+	drawStatusBar()
+	renderer.Refresh()
+	drainInput()
 }
 
 func drawDoneScreen() {
 	sceneClear()
-	fbinkClear()
+	renderer.Clear()
 
 	// Back button: full width, half the height of a rating button
 	gap := screenW / 30
-	btnH := (actionRect.H - 2*gap) / 4
+	btnH := backButtonH(gap)
 	backRect := Rect{gap / 2, gap / 2, screenW - gap, btnH}
 	drawButton("back", backRect, "Back", FontMenu, cfg.SizeMenu/2)
 
-	// "Done!" centered
-	topHalf := Rect{contentRect.X, contentRect.Y, contentRect.W, contentRect.H / 2}
-	drawLabel(topHalf, "Done!", FontMenu, cfg.SizeCard, "")
+	titleRect := Rect{contentRect.X, backRect.Y + backRect.H + gap, contentRect.W, contentRect.H / 8}
+	drawLabel(titleRect, "Done!", FontMenu, cfg.SizeCard, "")
+	subRect := Rect{contentRect.X, titleRect.Y + titleRect.H, contentRect.W, contentRect.H / 12}
+	drawFittedLines(subRect, plainLines(fmt.Sprintf("No more cards due in %s", currentDeck)), FontMenu, cfg.SizeMenu*3/4, "")
+
+	// Session summary: label on the left, value on the right
+	var rows [][2]string
+	if n := session.Reviews(); n > 0 {
+		rows = [][2]string{
+			{"Reviewed", strconv.Itoa(n)},
+			{"Time", fmt.Sprintf("%d min", max(int(session.Duration().Round(time.Minute).Minutes()), 1))},
+			{"Again", strconv.Itoa(session.Ratings[fsrs.Again])},
+			{"Hard", strconv.Itoa(session.Ratings[fsrs.Hard])},
+			{"Good", strconv.Itoa(session.Ratings[fsrs.Good])},
+			{"Easy", strconv.Itoa(session.Ratings[fsrs.Easy])},
+			{"New cards", strconv.Itoa(session.New)},
+			{"Lapses", strconv.Itoa(session.Lapses)},
+		}
+	}
+	size := cfg.SizeMenu * 3 / 4
+	rowH := screenH * 45 / 1000
+	top := subRect.Y + subRect.H + gap
+	for i, row := range rows {
+		r := Rect{contentRect.X + screenW/10, top + i*rowH, contentRect.W - screenW/5, rowH}
+		renderer.TextRect(vcenter(r, size), row[0], FontMenu, size, "", AlignLeft)
+		renderer.TextRect(vcenter(r, size), row[1], FontMenu, size, "", AlignRight)
+	}
 
-	botHalf := Rect{contentRect.X, contentRect.Y + contentRect.H/2, contentRect.W, contentRect.H / 2}
-	drawLabel(botHalf, fmt.Sprintf("No more cards due in %s", currentDeck), FontMenu, cfg.SizeMenu, "")
+	next := "No cards scheduled"
+	if due := core.NextDue(cards); !due.IsZero() {
+		next = "Next card due " + core.FormatDue(due, time.Now())
+	}
+	nextRect := Rect{contentRect.X, top + len(rows)*rowH + gap, contentRect.W, contentRect.H / 12}
+	drawLabel(nextRect, next, FontMenu, cfg.SizeMenu, "")
 
 	// Any touch goes back to decks
 	sceneAdd("any", contentRect)
 	sceneAdd("any", actionRect)
 
-	fbinkRefresh()
-	drainTouch()
+	drawStatusBar()
+	renderer.Refresh()
+	drainInput()
+}
+
+// drawActionsScreen offers what can be done to the current card besides
+// rating it: bury, reset or delete (with a second tap to confirm).
+func drawActionsScreen() {
+	sceneClear()
+	renderer.Clear()
+
+	gap := screenW / 30
+	btnH := backButtonH(gap)
+	backRect := Rect{gap / 2, gap / 2, screenW - gap, btnH}
+	drawButton("back", backRect, "Back", FontMenu, cfg.SizeMenu/2)
+
+	frontTop := backRect.Y + backRect.H + gap
+	frontRect := Rect{contentRect.X, frontTop, contentRect.W, contentRect.H/3 - gap}
+	drawFittedLabel(frontRect, displayFront(), FontFront, cfg.SizeMenu, "GRAY8")
+
+	listTop := frontRect.Y + frontRect.H + gap
+	rows := splitV(inset(Rect{0, listTop, screenW, screenH - listTop}, gap/2), 3, gap)
+	drawButton("bury", rows[0], "Bury until tomorrow", FontMenu, cfg.SizeMenu/2)
+	drawButton("forget", rows[1], "Reset progress", FontMenu, cfg.SizeMenu/2)
+	if confirmDelete {
+		drawButton("delete-confirm", rows[2], "Tap again to delete", FontMenu, cfg.SizeMenu/2)
+	} else {
+		drawButton("delete", rows[2], "Delete card", FontMenu, cfg.SizeMenu/2)
+	}
+
+	drawStatusBar()
+	renderer.Refresh()
+	drainInput()
 }
 
 // ============================================================
 // Main loop
 // ============================================================
 
-func rateAndAdvance(rating fsrs.Rating) Screen {
+// updateAndAdvance applies fn to the current card, saves the deck and moves
+// on to the next due card.
+func updateAndAdvance(fn func(*core.Card)) Screen {
 	card := core.FindCard(cards, currentCard.Front)
 	if card != nil {
-		core.Review(card, rating)
+		fn(card)
 		core.SaveCards(csvFile, cards)
 	}
+	return nextCard()
+}
+
+func rateAndAdvance(rating fsrs.Rating) Screen {
+	return updateAndAdvance(func(c *core.Card) { session.Review(c, rating) })
+}
+
+// nextCard draws the next due card, or the done screen if there is none.
+func nextCard() Screen {
 	currentCard = randomDueCard()
+	cardPage = 0
 	if currentCard == nil {
 		drawDoneScreen()
 		return ScreenDone
@@ -759,59 +1148,294 @@ func rateAndAdvance(rating fsrs.Rating) Screen {
 func main() {
 	fbinkPath = findFbink()
 	debug = os.Getenv("DEBUG") == "1"
+	recordPath := flag.String("record", "", "record raw touch events to `file`")
+	replayPath := flag.String("replay", "", "replay touch events from `file` instead of the touchscreen")
+	calibrateTouch := flag.Bool("calibrate", false, "calibrate the touchscreen and save the result to anki-fbink.conf")
+	flag.Parse()
 
-	coreCfg := core.LoadCoreConfig("anki-core.conf")
+	coreCfg = core.LoadCoreConfig(coreConfigPath)
 	dataDir = coreCfg.DataDir
 	reverseMode = coreCfg.Reverse
 	core.InitScheduler(coreCfg.RequestRetention, coreCfg.MaximumInterval, coreCfg.EnableShortTerm)
 
 	loadConfig()
-	detectScreen()
+	var fbinkID int
+	var screenKnown bool
+	if cfg.Renderer != "image" {
+		fbinkID, screenKnown = detectScreen()
+	}
+	applyDeviceProfile(fbinkID, screenKnown)
+	initFrontlight()
 	computeLayout()
+	renderer = newRenderer(cfg.Renderer)
+	audio = newAudioPlayer(cfg.AudioPlayer)
 
 	// CLI arg overrides config
-	if len(os.Args) > 1 {
-		dataDir = os.Args[1]
+	if flag.NArg() > 0 {
+		dataDir = flag.Arg(0)
+	}
+	for _, name := range core.InvalidDecks(dataDir) {
+		fmt.Fprintf(os.Stderr, "Warning: skipping %s.csv: not a valid deck name\n", name)
 	}
 
+	in, closeInput, err := openInput(*replayPath, *recordPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer closeInput()
+	input = in
+	if *calibrateTouch {
+		if err := calibrate(); err != nil {
+			fmt.Fprintf(os.Stderr, "calibrate: %v\n", err)
+		}
+	}
+
+	run()
+}
+
+// openTouch grabs the touchscreen and sets touchSource; tests replace it.
+var openTouch = func() error {
 	if err := grabTouchDevice(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: could not grab touch device: %v\n", err)
+		return err
+	}
+	probeTouchRanges(touchFd)
+	return nil
+}
+
+// openInput sets up touchSource and the key devices from the -replay and
+// -record flags and cfg, and returns the input run reads from, plus a
+// function that releases it all.
+func openInput(replayPath, recordPath string) (InputSource, func(), error) {
+	var closers []func()
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+	var sources []InputSource
+	switch {
+	case replayPath != "":
+		src, err := openReplay(replayPath)
+		if err != nil {
+			return nil, closeAll, fmt.Errorf("replay: %v", err)
+		}
+		touchSource = src
+		sources = append(sources, touchInput{})
+	case cfg.Input == "stdin":
+		sources = append(sources, newStdinInput(os.Stdin))
+	case cfg.Input != "none":
+		if err := openTouch(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not grab touch device: %v\n", err)
+		} else {
+			sources = append(sources, touchInput{})
+		}
+		closers = append(closers, releaseTouchDevice)
+	}
+
+	if recordPath != "" && touchSource != nil {
+		rec, err := newRecorder(touchSource, recordPath)
+		if err != nil {
+			return nil, closeAll, fmt.Errorf("record: %v", err)
+		}
+		closers = append(closers, func() { rec.Close() })
+		touchSource = rec
+	}
+
+	// An external keyboard, the page-turn buttons some models have, and
+	// the power button; often two of these are the same device.
+	var keyDevices []string
+	for _, path := range []string{
+		keyDevicePath(cfg.Keyboard, findKeyboardDevice),
+		keyDevicePath(cfg.PageKeys, findPageKeysDevice),
+		keyDevicePath(cfg.PowerKey, findPowerKeyDevice),
+	} {
+		if path != "" && !slices.Contains(keyDevices, path) {
+			keyDevices = append(keyDevices, path)
+		}
+	}
+	for _, path := range keyDevices {
+		if k, err := openKeyboard(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			sources = append(sources, k)
+		}
+	}
+
+	if len(sources) == 0 {
+		return nil, closeAll, errors.New("No input sources available")
+	}
+	// Ticks let run check the battery and update the clock while idle.
+	return mergeInputs(statusInterval, sources...), closeAll, nil
+}
+
+// defaultKeys maps key names to scene element IDs per screen, so keys
+// reuse the same handling as taps.
+var defaultKeys = map[Screen]map[string]string{
+	ScreenDecks: {"next": "next", "prev": "prev", "back": "reverse", "q": "exit", "s": "settings", "l": "light"},
+	ScreenFront: {"enter": "show", "next": "show", "back": "back", "l": "light"},
+	ScreenBack: {"1": "again", "2": "hard", "3": "good", "4": "easy",
+		"enter": "good", "next": "good", "prev": "again", "back": "back", "p": "play", "l": "light"},
+	ScreenDone:     {"enter": "any", "next": "any", "back": "any"},
+	ScreenActions:  {"1": "bury", "2": "forget", "3": "delete", "back": "back"},
+	ScreenSettings: {"enter": "back", "back": "back", "c": "calibrate"},
+	ScreenStats:    {"enter": "study", "back": "back"},
+	ScreenLight:    {"next": "light-inc", "prev": "light-dec", "enter": "back", "back": "back"},
+}
+
+// screenNames are the screens' names in keys_<screen> config keys.
+var screenNames = map[string]Screen{
+	"decks":    ScreenDecks,
+	"front":    ScreenFront,
+	"back":     ScreenBack,
+	"done":     ScreenDone,
+	"actions":  ScreenActions,
+	"settings": ScreenSettings,
+	"stats":    ScreenStats,
+	"light":    ScreenLight,
+}
+
+// screenKeys returns the key bindings for screen: cfg.Keys if the config
+// changed them, else defaultKeys.
+func screenKeys(screen Screen) map[string]string {
+	if keys, ok := cfg.Keys[screen]; ok {
+		return keys
 	}
-	defer releaseTouchDevice()
+	return defaultKeys[screen]
+}
 
+// setScreenKeys applies a keys_<screen> value, a comma-separated list of
+// key:id pairs, on top of the screen's bindings in cfg.Keys, which start
+// as a copy of defaultKeys. An empty id unmaps the key.
+func setScreenKeys(screen Screen, value string) {
+	if cfg.Keys == nil {
+		cfg.Keys = map[Screen]map[string]string{}
+	}
+	keys, ok := cfg.Keys[screen]
+	if !ok {
+		keys = maps.Clone(defaultKeys[screen])
+		cfg.Keys[screen] = keys
+	}
+	for _, pair := range strings.Split(value, ",") {
+		key, id, ok := strings.Cut(pair, ":")
+		key, id = strings.TrimSpace(key), strings.TrimSpace(id)
+		if !ok || key == "" {
+			continue
+		}
+		if id == "" {
+			delete(keys, key)
+		} else {
+			keys[key] = id
+		}
+	}
+}
+
+// eventTarget resolves an input event to the scene element ID it activates.
+func eventTarget(screen Screen, ev Event) string {
+	switch ev.Kind {
+	case EventTap:
+		return sceneHitTest(ev.X, ev.Y)
+	case EventKey:
+		// Digits pick a deck on the current page.
+		if n, err := strconv.Atoi(ev.Key); err == nil && screen == ScreenDecks && n >= 1 && n <= decksPerPage {
+			return fmt.Sprintf("deck-%d", deckPage*decksPerPage+n-1)
+		}
+		id := screenKeys(screen)[ev.Key]
+		if screen == ScreenBack && isRating(id) && !inScene(id) {
+			return "" // e.g. Hard and Easy in pass/fail mode
+		}
+		return id
+	case EventSwipe:
+		return gestureTarget("swipe_" + ev.Dir.String())
+	case EventLongPress:
+		// Long-pressing a deck row opens its stats.
+		if id := sceneHitTest(ev.X, ev.Y); screen == ScreenDecks && strings.HasPrefix(id, "deck-") {
+			return "stats-" + strings.TrimPrefix(id, "deck-")
+		}
+		return gestureTarget("long_press")
+	}
+	return ""
+}
+
+func turnCardPage(id string) {
+	if id == "page-next" {
+		cardPage++
+	} else if cardPage > 0 {
+		cardPage--
+	}
+}
+
+// openDeck loads a deck and shows its first due card.
+func openDeck(deck core.DeckName) Screen {
+	currentDeck = deck
+	csvFile = core.DeckCSVPath(dataDir, currentDeck)
+	cards, _ = core.LoadCards(csvFile)
+	session = core.NewSession(deck, time.Now())
+	currentCard = randomDueCard()
+	cardPage = 0
+	if currentCard == nil {
+		drawDoneScreen()
+		return ScreenDone
+	}
+	drawFrontScreen()
+	return ScreenFront
+}
+
+func openActions(from Screen) Screen {
+	actionsFrom = from
+	confirmDelete = false
+	drawActionsScreen()
+	return ScreenActions
+}
+
+// run draws the deck list and handles input until Quit or end of input.
+func run() {
 	screen := ScreenDecks
 	drawDecksScreen()
 
 	for {
-		ev, ok := readTouch()
-		if !ok {
+		if b, low := lowBattery(); low {
+			saveState(screen)
+			drawLowBatteryScreen(b)
+			return
+		}
+
+		ev, err := input.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
 			continue
 		}
 
-		now := time.Now()
-		if now.Sub(lastTouchTime) < touchCooldown {
-			if debug {
-				fmt.Printf("Touch ignored (cooldown)\n")
-			}
+		if ev.Kind == EventTick {
+			refreshStatusBar(screen)
+			continue
+		}
+		if ev.Kind == EventKey && ev.Key == "power" {
+			suspend(screen)
 			continue
 		}
-		lastTouchTime = now
 
-		id := sceneHitTest(ev.X, ev.Y)
+		id := eventTarget(screen, ev)
 		if debug {
-			fmt.Printf("Touch: x=%d y=%d id=%q screen=%d\n", ev.X, ev.Y, id, screen)
+			fmt.Printf("Input: %+v id=%q screen=%d\n", ev, id, screen)
 		}
 
 		switch screen {
 		case ScreenDecks:
 			switch {
 			case id == "exit":
-				fbinkClear()
-				fbinkRefresh()
+				renderer.Clear()
+				renderer.Refresh()
 				return
 			case id == "reverse":
 				reverseMode = !reverseMode
 				drawDecksScreen()
+			case id == "settings":
+				screen = openSettings()
+			case id == "light" && hasFrontlight():
+				screen = openLight(screen)
 			case id == "prev" && deckPage > 0:
 				deckPage--
 				drawDecksScreen()
@@ -821,27 +1445,39 @@ func main() {
 			case strings.HasPrefix(id, "deck-"):
 				idx, _ := strconv.Atoi(strings.TrimPrefix(id, "deck-"))
 				if idx >= 0 && idx < len(decks) {
-					currentDeck = decks[idx]
-					csvFile = core.DeckCSVPath(dataDir, currentDeck)
-					cards, _ = core.LoadCards(csvFile)
-					currentCard = randomDueCard()
-					if currentCard == nil {
-						screen = ScreenDone
-						drawDoneScreen()
-					} else {
-						screen = ScreenFront
-						drawFrontScreen()
-					}
+					screen = openDeck(decks[idx])
+				}
+			case strings.HasPrefix(id, "stats-"):
+				idx, _ := strconv.Atoi(strings.TrimPrefix(id, "stats-"))
+				if idx >= 0 && idx < len(decks) {
+					screen = openStats(decks[idx])
 				}
 			}
 
+		case ScreenStats:
+			switch id {
+			case "back":
+				screen = ScreenDecks
+				drawDecksScreen()
+			case "study":
+				screen = openDeck(statsDeck)
+			}
+
 		case ScreenFront:
 			if id == "back" {
 				screen = ScreenDecks
 				drawDecksScreen()
 			} else if id == "show" {
 				screen = ScreenBack
+				cardPage = 0
 				drawBackScreen()
+			} else if id == "page-prev" || id == "page-next" {
+				turnCardPage(id)
+				drawFrontScreen()
+			} else if id == "actions" {
+				screen = openActions(screen)
+			} else if id == "light" && hasFrontlight() {
+				screen = openLight(screen)
 			}
 
 		case ScreenBack:
@@ -857,6 +1493,72 @@ func main() {
 				screen = rateAndAdvance(fsrs.Good)
 			case "easy":
 				screen = rateAndAdvance(fsrs.Easy)
+			case "page-prev", "page-next":
+				turnCardPage(id)
+				drawBackScreen()
+			case "play":
+				if err := audio.Play(cardSounds()); err != nil && debug {
+					fmt.Printf("audio error: %v\n", err)
+				}
+			case "actions":
+				screen = openActions(screen)
+			case "light":
+				if hasFrontlight() {
+					screen = openLight(screen)
+				}
+			}
+
+		case ScreenLight:
+			switch {
+			case id == "back":
+				if err := saveLight(); err != nil {
+					fmt.Fprintf(os.Stderr, "frontlight: %v\n", err)
+				}
+				screen = lightFrom
+				redrawScreen(screen)
+			case strings.HasPrefix(id, "light-"), strings.HasPrefix(id, "warmth-"):
+				changeLight(id)
+				drawLightScreen()
+			}
+
+		case ScreenSettings:
+			switch {
+			case id == "back":
+				if err := saveSettings(); err != nil {
+					fmt.Fprintf(os.Stderr, "settings: %v\n", err)
+				}
+				screen = ScreenDecks
+				drawDecksScreen()
+			case strings.HasPrefix(id, "set-"):
+				changeSetting(id)
+				drawSettingsScreen()
+			case id == "calibrate":
+				if err := calibrate(); err != nil {
+					fmt.Fprintf(os.Stderr, "calibrate: %v\n", err)
+				}
+				drawSettingsScreen()
+			}
+
+		case ScreenActions:
+			switch id {
+			case "back":
+				screen = actionsFrom
+				if screen == ScreenBack {
+					drawBackScreen()
+				} else {
+					drawFrontScreen()
+				}
+			case "bury":
+				screen = updateAndAdvance(core.Bury)
+			case "forget":
+				screen = updateAndAdvance(core.Forget)
+			case "delete":
+				confirmDelete = true
+				drawActionsScreen()
+			case "delete-confirm":
+				cards = core.RemoveCard(cards, currentCard.Front)
+				core.SaveCards(csvFile, cards)
+				screen = nextCard()
 			}
 
 		case ScreenDone:
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"kobo-anki/core"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ============================================================
+// Power button: sleep screen and suspend to RAM
+// ============================================================
+
+// sysfsRoot is where the kernel's sysfs is mounted; tests point it at a
+// fake directory.
+var sysfsRoot = "/sys"
+
+var (
+	// suspendDelay lets the panel finish the sleep screen before the
+	// system stops, as Nickel does.
+	suspendDelay = 2 * time.Second
+	// wakeGuard ignores the power press that woke the device, should it
+	// arrive after resume.
+	wakeGuard = 2 * time.Second
+	lastWake  time.Time
+)
+
+// sysfsWrite writes value to a file below sysfsRoot.
+func sysfsWrite(rel, value string) error {
+	return os.WriteFile(filepath.Join(sysfsRoot, rel), []byte(value), 0644)
+}
+
+// suspendSystem puts the device to sleep and returns once it wakes up.
+// Kobo kernels want power/state-extended set around the usual write of
+// "mem" to power/state, which blocks until resume; kernels without it
+// only get the latter.
+func suspendSystem() error {
+	extended := filepath.Join(sysfsRoot, "power", "state-extended")
+	if _, err := os.Stat(extended); err == nil {
+		if err := sysfsWrite("power/state-extended", "1"); err != nil {
+			return err
+		}
+		defer sysfsWrite("power/state-extended", "0")
+	}
+	time.Sleep(suspendDelay)
+	return sysfsWrite("power/state", "mem")
+}
+
+// suspend shows the sleep screen, saves the open deck, hands the
+// touchscreen back to the system, turns the frontlight off and suspends; on
+// wake it restores the light and redraws screen.
+func suspend(screen Screen) {
+	if clock().Sub(lastWake) < wakeGuard {
+		return
+	}
+	drawSleepScreen()
+	saveState(screen)
+	level := lightLevel
+	if hasFrontlight() && level > 0 {
+		setLight(0)
+	}
+
+	if err := setTouchGrab(false); err != nil && debug {
+		fmt.Printf("suspend: %v\n", err)
+	}
+	if err := suspendSystem(); err != nil {
+		fmt.Fprintf(os.Stderr, "suspend: %v\n", err)
+	}
+	if err := setTouchGrab(true); err != nil {
+		fmt.Fprintf(os.Stderr, "resume: %v\n", err)
+	}
+	if hasFrontlight() && level > 0 {
+		setLight(level)
+	}
+	lastWake = clock()
+	drainInput()
+	redrawScreen(screen)
+}
+
+// saveState writes out the open deck, and the settings or frontlight if
+// they are being edited, before the app may lose power.
+func saveState(screen Screen) {
+	if csvFile != "" && cards != nil {
+		core.SaveCards(csvFile, cards)
+	}
+	if screen == ScreenSettings {
+		if err := saveSettings(); err != nil {
+			fmt.Fprintf(os.Stderr, "settings: %v\n", err)
+		}
+	}
+	if screen == ScreenLight {
+		if err := saveLight(); err != nil {
+			fmt.Fprintf(os.Stderr, "frontlight: %v\n", err)
+		}
+	}
+}
+
+// redrawScreen draws screen again from the current state.
+func redrawScreen(screen Screen) {
+	switch screen {
+	case ScreenFront:
+		drawFrontScreen()
+	case ScreenBack:
+		drawBackScreen()
+	case ScreenDone:
+		drawDoneScreen()
+	case ScreenActions:
+		drawActionsScreen()
+	case ScreenSettings:
+		drawSettingsScreen()
+	case ScreenStats:
+		drawStatsScreen()
+	case ScreenLight:
+		drawLightScreen()
+	default:
+		drawDecksScreen()
+	}
+}
+
+// drawSleepScreen is left on the panel while the device sleeps: what is
+// due in each deck, so the reader knows whether to pick it up again.
+func drawSleepScreen() {
+	sceneClear()
+	renderer.Clear()
+
+	titleRect := Rect{contentRect.X, screenH / 10, contentRect.W, screenH / 10}
+	drawLabel(titleRect, "Sleeping", FontMenu, cfg.SizeTitle, "")
+
+	size := cfg.SizeMenu * 3 / 4
+	rowH := screenH * 45 / 1000
+	top := titleRect.Y + titleRect.H + screenH/20
+	total := 0
+	deckList := core.ListDecks(dataDir)
+	maxRows := (screenH*3/4 - top) / rowH
+	for i, d := range deckList {
+		c, _ := core.LoadCards(core.DeckCSVPath(dataDir, d))
+		due := core.CountDueCards(c)
+		total += due
+		if i >= maxRows {
+			continue
+		}
+		r := Rect{contentRect.X + screenW/10, top + i*rowH, contentRect.W - screenW/5, rowH}
+		renderer.TextRect(vcenter(r, size), string(d), FontMenu, size, "", AlignLeft)
+		renderer.TextRect(vcenter(r, size), fmt.Sprintf("%d due", due), FontMenu, size, "", AlignRight)
+	}
+
+	summary := fmt.Sprintf("%d cards due", total)
+	if total == 1 {
+		summary = "1 card due"
+	}
+	drawLabel(Rect{contentRect.X, screenH * 3 / 4, contentRect.W, screenH / 12}, summary, FontMenu, cfg.SizeMenu, "")
+	drawLabel(Rect{contentRect.X, screenH*3/4 + screenH/12, contentRect.W, screenH / 12}, "Press the power button to wake", FontMenu, cfg.SizeMenu/2, "GRAY8")
+
+	renderer.Refresh()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSysfs points sysfsRoot at a temp directory with the power files a
+// Kobo kernel has.
+func fakeSysfs(t *testing.T) string {
+	t.Helper()
+	saved, savedDelay := sysfsRoot, suspendDelay
+	t.Cleanup(func() { sysfsRoot, suspendDelay = saved, savedDelay })
+	sysfsRoot, suspendDelay = t.TempDir(), 0
+	os.MkdirAll(filepath.Join(sysfsRoot, "power"), 0755)
+	os.WriteFile(filepath.Join(sysfsRoot, "power", "state"), nil, 0644)
+	os.WriteFile(filepath.Join(sysfsRoot, "power", "state-extended"), []byte("0"), 0644)
+	return sysfsRoot
+}
+
+func TestSuspendAndResume(t *testing.T) {
+	ir := setupImageScreen(t)
+	root := fakeSysfs(t)
+	defer func() { input = nil }()
+
+	// Open the deck, press power on the front screen, then carry on: the
+	// front screen must be back after waking. The second press comes
+	// straight after the wake and is ignored.
+	input = newStdinInput(strings.NewReader("1\npower\npower\nenter\n3\nback\nq\n"))
+	run()
+
+	if data, _ := os.ReadFile(filepath.Join(root, "power", "state")); string(data) != "mem" {
+		t.Errorf("power/state = %q, want mem", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "power", "state-extended")); string(data) != "0" {
+		t.Errorf("power/state-extended = %q, want 0 after resume", data)
+	}
+	if n := reviewedCount(t); n != 1 {
+		t.Fatalf("reviewed %d cards after resume, want 1", n)
+	}
+	// decks, front, sleep, front again, back, next card, decks, cleared
+	if ir.Frames != 8 {
+		t.Errorf("%d frames drawn, want 8", ir.Frames)
+	}
+}
+
+func TestFindPowerKeyDevice(t *testing.T) {
+	saved := procInputDevices
+	defer func() { procInputDevices = saved }()
+	procInputDevices = filepath.Join(t.TempDir(), "devices")
+	os.WriteFile(procInputDevices, []byte(`N: Name="cyttsp5_mt"
+H: Handlers=event1
+
+N: Name="bd71828-pwrkey"
+H: Handlers=kbd event2
+`), 0644)
+	if got := findPowerKeyDevice(); got != "/dev/input/event2" {
+		t.Errorf("power key: %q, want /dev/input/event2", got)
+	}
+	if got := findKeyboardDevice(); got != "" {
+		t.Errorf("power key taken for a keyboard: %q", got)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Touch recording and replay
+// ============================================================
+//
+// Recordings are plain text, one record per line:
+//
+//	E <unix seconds>.<micros> <type> <code> <value>   an evdev event
+//	D <unix seconds>.<micros>                         a drainTouch after a redraw
+//
+// Only events consumed by readTouch are recorded; events discarded by a
+// drain are not, so replay sees exactly what the app acted on. Drain markers
+// carry the wall time of the drain so touch cooldowns replay identically.
+
+const recordingHeader = "# kobo-anki touch recording v1"
+
+func formatStamp(t time.Time) string {
+	return fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000)
+}
+
+func parseStamp(s string) (time.Time, error) {
+	sec, usec, _ := strings.Cut(s, ".")
+	a, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var b int64
+	if usec != "" {
+		if b, err = strconv.ParseInt(usec, 10, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(a, b*1000), nil
+}
+
+// recorder passes events through from src and logs them to a file.
+type recorder struct {
+	src evdevSource
+	f   *os.File
+	w   *bufio.Writer
+}
+
+func newRecorder(src evdevSource, path string) (*recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{src: src, f: f, w: bufio.NewWriter(f)}
+	fmt.Fprintln(r.w, recordingHeader)
+	return r, r.w.Flush()
+}
+
+func (r *recorder) ReadEvent() (evdevEvent, error) {
+	ev, err := r.src.ReadEvent()
+	if err == nil {
+		fmt.Fprintf(r.w, "E %s %d %d %d\n", formatStamp(ev.Time), ev.Type, ev.Code, ev.Value)
+		// Flush per event: the app is usually ended by a reboot, not Close.
+		r.w.Flush()
+	}
+	return ev, err
+}
+
+func (r *recorder) Drain() {
+	r.src.Drain()
+	fmt.Fprintf(r.w, "D %s\n", formatStamp(clock()))
+	r.w.Flush()
+}
+
+func (r *recorder) Close() error {
+	r.w.Flush()
+	return r.f.Close()
+}
+
+// replay feeds a recording back as an evdevSource and drives clock from
+// the recorded timestamps.
+type replay struct {
+	lines []string
+	pos   int
+	now   time.Time
+}
+
+func openReplay(path string) (*replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return newReplay(f)
+}
+
+func newReplay(r io.Reader) (*replay, error) {
+	rp := &replay{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		rp.lines = append(rp.lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	clock = func() time.Time { return rp.now }
+	return rp, nil
+}
+
+func (rp *replay) ReadEvent() (evdevEvent, error) {
+	for rp.pos < len(rp.lines) {
+		line := rp.lines[rp.pos]
+		rp.pos++
+		f := strings.Fields(line)
+		switch {
+		case f[0] == "D" && len(f) == 2:
+			// Drain recorded where replay didn't drain; just follow the clock.
+			if t, err := parseStamp(f[1]); err == nil {
+				rp.now = t
+			}
+		case f[0] == "E" && len(f) == 5:
+			t, err := parseStamp(f[1])
+			typ, err1 := strconv.ParseUint(f[2], 10, 16)
+			code, err2 := strconv.ParseUint(f[3], 10, 16)
+			val, err3 := strconv.ParseInt(f[4], 10, 32)
+			if err != nil || err1 != nil || err2 != nil || err3 != nil {
+				return evdevEvent{}, fmt.Errorf("replay line %d: bad event %q", rp.pos, line)
+			}
+			rp.now = t
+			return evdevEvent{Time: t, Type: uint16(typ), Code: uint16(code), Value: int32(val)}, nil
+		default:
+			return evdevEvent{}, fmt.Errorf("replay line %d: unknown record %q", rp.pos, line)
+		}
+	}
+	return evdevEvent{}, io.EOF
+}
+
+// Drain consumes the matching drain marker, if the recording has one here.
+func (rp *replay) Drain() {
+	if rp.pos >= len(rp.lines) {
+		return
+	}
+	f := strings.Fields(rp.lines[rp.pos])
+	if len(f) == 2 && f[0] == "D" {
+		if t, err := parseStamp(f[1]); err == nil {
+			rp.now = t
+		}
+		rp.pos++
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"kobo-anki/core"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// scriptSource taps the centre of the named scene elements in order,
+// producing the raw evdev events the Kobo touchscreen would.
+type scriptSource struct {
+	ids     []string
+	pending []evdevEvent
+	t       time.Time
+}
+
+func (s *scriptSource) ReadEvent() (evdevEvent, error) {
+	if len(s.pending) == 0 {
+		if len(s.ids) == 0 {
+			return evdevEvent{}, io.EOF
+		}
+		id := s.ids[0]
+		s.ids = s.ids[1:]
+		var r *Rect
+		for i := range scene {
+			if scene[i].ID == id {
+				r = &scene[i].Rect
+			}
+		}
+		if r == nil {
+			return evdevEvent{}, io.EOF
+		}
+		rawX, rawY := rawTouch(r.X+r.W/2, r.Y+r.H/2)
+		s.t = s.t.Add(time.Second)
+		s.pending = []evdevEvent{
+			{s.t, 1, 330, 1},
+			{s.t, 3, 53, int32(rawX)},
+			{s.t, 3, 54, int32(rawY)},
+			{s.t, 0, 0, 0},
+			{s.t, 1, 330, 0},
+			{s.t, 0, 0, 0},
+		}
+	}
+	ev := s.pending[0]
+	s.pending = s.pending[1:]
+	return ev, nil
+}
+
+func (s *scriptSource) Drain() {}
+
+func resetDeck(t *testing.T) {
+	t.Helper()
+	path := core.DeckCSVPath(dataDir, "dutch")
+	if err := core.SaveCards(path, []core.Card{{Front: "hallo", Back: "hello"}, {Front: "fiets", Back: "bicycle"}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func reviewedCount(t *testing.T) int {
+	t.Helper()
+	cards, err := core.LoadCards(core.DeckCSVPath(dataDir, "dutch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, c := range cards {
+		if c.Reps > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// useInput opens the input the way main does for the given flags, with
+// script standing in for the touchscreen.
+func useInput(t *testing.T, script evdevSource, replayPath, recordPath string) func() {
+	t.Helper()
+	openTouch = func() error {
+		touchSource = script
+		return nil
+	}
+	in, closeInput, err := openInput(replayPath, recordPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input = in
+	return closeInput
+}
+
+func TestRecordAndReplaySession(t *testing.T) {
+	ir := setupImageScreen(t)
+	oldCfg, oldProc, oldOpen := cfg, procInputDevices, openTouch
+	defer func() {
+		cfg, procInputDevices, openTouch = oldCfg, oldProc, oldOpen
+		clock = time.Now
+		touchSource, input = nil, nil
+	}()
+	cfg.Input, cfg.Keyboard, cfg.PageKeys, cfg.PowerKey = "touch", "auto", "auto", "auto"
+	procInputDevices = filepath.Join(t.TempDir(), "devices") // no key devices
+	recPath := filepath.Join(t.TempDir(), "session.txt")
+
+	// Record: open the deck, answer both cards Good, leave the done screen, quit.
+	script := &scriptSource{
+		ids: []string{"deck-0", "show", "good", "show", "good", "any", "exit"},
+		t:   time.Unix(1700000000, 0),
+	}
+	clock = func() time.Time { return script.t }
+	closeInput := useInput(t, script, "", recPath)
+	run()
+	closeInput()
+	if n := reviewedCount(t); n != 2 {
+		t.Fatalf("recorded session reviewed %d cards, want 2", n)
+	}
+	want := append([]byte(nil), ir.Img.Pix...)
+	log, err := os.ReadFile(recPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(log, []byte("\nD ")) {
+		t.Fatal("recording has no drain markers")
+	}
+
+	// Replay against a fresh deck: same taps must give the same outcome.
+	resetDeck(t)
+	ir.Clear()
+	closeInput = useInput(t, nil, recPath, "")
+	rp := touchSource.(*replay)
+	run()
+	closeInput()
+	if n := reviewedCount(t); n != 2 {
+		t.Fatalf("replayed session reviewed %d cards, want 2", n)
+	}
+	if !bytes.Equal(ir.Img.Pix, want) {
+		t.Fatal("replay ended on a different screen than the recording")
+	}
+	if rp.pos != len(rp.lines) {
+		t.Fatalf("replay stopped at record %d of %d", rp.pos, len(rp.lines))
+	}
+}
+
+func TestReplayCooldown(t *testing.T) {
+	setupImageScreen(t)
+	defer func() { clock = time.Now; touchSource = nil; input = nil }()
+
+	// Two taps on "next" 100ms apart: the second falls in the cooldown.
+	var buf bytes.Buffer
+	buf.WriteString(recordingHeader + "\nD 1700000000.000000\n")
+	for _, ts := range []string{"1700000001.000000", "1700000001.100000"} {
+		buf.WriteString("E " + ts + " 1 330 1\nE " + ts + " 3 53 10\nE " + ts + " 3 54 10\nE " + ts + " 0 0 0\n")
+		buf.WriteString("E " + ts + " 1 330 0\nE " + ts + " 0 0 0\n")
+	}
+	rp, err := newReplay(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	touchSource = rp
+	taps := 0
+	for {
+		if _, err := (touchInput{}).Next(); err != nil {
+			break
+		}
+		taps++
+	}
+	if taps != 1 {
+		t.Fatalf("accepted %d taps, want 1 (second is within cooldown)", taps)
+	}
+}
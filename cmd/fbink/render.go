@@ -0,0 +1,98 @@
+package main
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"kobo-anki/core"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ============================================================
+// Renderer: drawing backend abstraction
+// ============================================================
+
+// Renderer is the drawing backend for the UI. Draw calls don't touch the
+// panel until Refresh, mirroring how FBInk's -b (no-refresh) mode is used.
+// Colors are FBInk names (BLACK, WHITE, GRAY1..GRAYE); "" means the default
+// (white fill, black text).
+type Renderer interface {
+	FillRect(r Rect, color string)
+	TextRect(r Rect, text string, font FontType, size int, color string, align Align)
+	// StyledText draws lines of styled text as they are, without wrapping.
+	StyledText(r Rect, lines []core.Line, font FontType, size int, color string, align Align)
+	// Image draws a PNG, JPEG or GIF file scaled to fit r, centered and
+	// dithered to the panel's 16 grays.
+	Image(r Rect, path string)
+	Clear()
+	Refresh()
+}
+
+// renderer is the active backend, selected by the "renderer" config key.
+var renderer Renderer = &execRenderer{}
+
+func newRenderer(name string) Renderer {
+	switch name {
+	case "image":
+		return newImageRenderer(screenW, screenH, cfg.ImageDir)
+	case "batch":
+		return newBatchRenderer(screenW, screenH)
+	default:
+		return &execRenderer{}
+	}
+}
+
+// textMargins returns FBInk's left/right TrueType margins for drawing text
+// in r. Right alignment is approximated by pushing the left margin, since
+// FBInk has no right-align flag; the image renderer copies this so previews
+// match the device.
+func textMargins(r Rect, align Align) (left, right int) {
+	left = r.X
+	right = screenW - (r.X + r.W)
+	if right < 0 {
+		right = 0
+	}
+	if align == AlignRight {
+		left = r.X + r.W*2/3
+	}
+	return left, right
+}
+
+// fitImage returns where an image file lands when scaled to fit r keeping
+// its aspect ratio, centered; false if it isn't a readable image.
+func fitImage(path string, r Rect) (Rect, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Rect{}, false
+	}
+	defer f.Close()
+	c, _, err := image.DecodeConfig(f)
+	if err != nil || c.Width <= 0 || c.Height <= 0 || r.W <= 0 || r.H <= 0 {
+		return Rect{}, false
+	}
+	w, h := r.W, c.Height*r.W/c.Width
+	if h > r.H {
+		w, h = c.Width*r.H/c.Height, r.H
+	}
+	return Rect{r.X + (r.W-w)/2, r.Y + (r.H-h)/2, max(w, 1), max(h, 1)}, true
+}
+
+// grayLevel maps an FBInk color name to its 8-bit gray value.
+func grayLevel(color string, def uint8) uint8 {
+	switch c := strings.ToUpper(color); {
+	case c == "":
+		return def
+	case c == "BLACK":
+		return 0x00
+	case c == "WHITE":
+		return 0xFF
+	case strings.HasPrefix(c, "GRAY") && len(c) == 5:
+		if v, err := strconv.ParseUint(c[4:], 16, 8); err == nil {
+			return uint8(v) * 0x11
+		}
+	}
+	return def
+}
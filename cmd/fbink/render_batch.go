@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// batchRenderer queues a whole frame into an offscreen buffer (via
+// imageRenderer) and pushes it to the panel with a single FBInk image
+// invocation on Refresh, instead of one fbink process per primitive.
+// Only the bounding box of pixels that changed since the last frame is sent,
+// so small updates stay fast partial refreshes.
+//
+// FBInk's own daemon mode can't be used for this: it only prints strings
+// with the options it was started with, not rects or positioned text.
+type batchRenderer struct {
+	*imageRenderer
+	prev    *image.Gray // last frame pushed to the panel; nil = unknown
+	tmpPath string
+}
+
+func newBatchRenderer(w, h int) *batchRenderer {
+	return &batchRenderer{
+		imageRenderer: newImageRenderer(w, h, ""),
+		tmpPath:       filepath.Join(os.TempDir(), "kobo-anki-frame.png"),
+	}
+}
+
+// dirtyRect returns the bounding box of pixels that differ between a and b.
+func dirtyRect(a, b *image.Gray) image.Rectangle {
+	if b == nil || a.Bounds() != b.Bounds() {
+		return a.Bounds()
+	}
+	r := image.Rectangle{}
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		rowA := a.Pix[a.PixOffset(bounds.Min.X, y):a.PixOffset(bounds.Max.X, y)]
+		rowB := b.Pix[b.PixOffset(bounds.Min.X, y):b.PixOffset(bounds.Max.X, y)]
+		minX, maxX := -1, -1
+		for x := range rowA {
+			if rowA[x] != rowB[x] {
+				if minX < 0 {
+					minX = x
+				}
+				maxX = x
+			}
+		}
+		if minX >= 0 {
+			r = r.Union(image.Rect(bounds.Min.X+minX, y, bounds.Min.X+maxX+1, y+1))
+		}
+	}
+	return r
+}
+
+func (br *batchRenderer) Refresh() {
+	br.Frames++
+	dirty := dirtyRect(br.Img, br.prev)
+	if dirty.Empty() {
+		return
+	}
+
+	crop := &imageRenderer{Img: br.Img.SubImage(dirty).(*image.Gray)}
+	if err := crop.WritePNG(br.tmpPath); err != nil {
+		fmt.Fprintf(os.Stderr, "batch renderer: %v\n", err)
+		return
+	}
+	// Night mode is already baked into the buffer, so no -H here.
+	img := "file=" + br.tmpPath + ",x=" + strconv.Itoa(dirty.Min.X) + ",y=" + strconv.Itoa(dirty.Min.Y)
+	args := []string{"-g", img}
+	if debug {
+		fmt.Printf("fbink: %v (%dx%d)\n", args, dirty.Dx(), dirty.Dy())
+	}
+	if out, err := exec.Command(fbinkPath, args...).CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "fbink error: %v, output: %s\n", err, string(out))
+		br.prev = nil // panel state unknown; resend everything next time
+		return
+	}
+
+	if br.prev == nil {
+		br.prev = image.NewGray(br.Img.Bounds())
+	}
+	copy(br.prev.Pix, br.Img.Pix)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"kobo-anki/core"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// execRenderer draws by running the fbink binary once per primitive.
+type execRenderer struct{}
+
+func (execRenderer) run(args []string) {
+	if debug {
+		fmt.Printf("fbink: %v\n", args)
+	}
+	out, err := exec.Command(fbinkPath, args...).CombinedOutput()
+	if err != nil && debug {
+		fmt.Printf("fbink error: %v, output: %s\n", err, string(out))
+	}
+}
+
+// FillRect fills a rectangle with a color (no screen refresh).
+func (execRenderer) FillRect(r Rect, color string) {
+	region := fmt.Sprintf("top=%d,left=%d,width=%d,height=%d", r.Y, r.X, r.W, r.H)
+	args := []string{"-k", region, "-b"}
+	if color != "" {
+		args = append(args, "-B", color)
+	}
+	if cfg.DarkMode {
+		args = append(args, "-H")
+	}
+	exec.Command(fbinkPath, args...).Run()
+}
+
+// TextRect draws text inside a rect (bgless overlay, no refresh).
+func (e execRenderer) TextRect(r Rect, text string, font FontType, size int, color string, align Align) {
+	fontPath := resolveFont(font)
+	if fontPath == "" {
+		// Fallback to bitmap font
+		row := r.Y * 20 / screenH
+		args := []string{"-y", strconv.Itoa(row), "-S", strconv.Itoa(size / 8), "-O", "-b"}
+		if align == AlignCenter {
+			args = append(args, "-m")
+		}
+		if color != "" {
+			args = append(args, "-C", color)
+		}
+		if cfg.DarkMode {
+			args = append(args, "-H")
+		}
+		e.run(append(args, text))
+		return
+	}
+
+	e.truetype(r, "regular="+fontPath, text, size, color, align)
+}
+
+// truetype prints text with FBInk's TrueType renderer; fonts is the
+// regular=... (and bold=... etc.) part of the -t options.
+func (e execRenderer) truetype(r Rect, fonts, text string, size int, color string, align Align) {
+	left, right := textMargins(r, align)
+	tt := fmt.Sprintf("%s,size=%d,top=%d,left=%d,right=%d",
+		fonts, size, r.Y, left, right)
+
+	args := []string{"-t", tt, "-O", "-b"}
+	if align == AlignCenter {
+		args = append(args, "-m")
+	}
+	if color != "" {
+		args = append(args, "-C", color)
+	}
+	if cfg.DarkMode {
+		args = append(args, "-H")
+	}
+	e.run(append(args, text))
+}
+
+// StyledText draws styled lines using FBInk's "format" option, which reads
+// *italic*, **bold** and ***bold italic*** markup and takes the style
+// fonts as bold=, italic= and bolditalic=. Literal asterisks are swapped
+// for a lookalike so they aren't read as markup. Text without styles, or
+// without a TrueType font, is drawn as plain TextRect text.
+func (e execRenderer) StyledText(r Rect, lines []core.Line, font FontType, size int, color string, align Align) {
+	styled := false
+	plain := make([]string, len(lines))
+	for i, l := range lines {
+		plain[i] = l.String()
+		for _, sp := range l {
+			styled = styled || sp.Style != 0
+		}
+	}
+	fontPath := resolveFont(font)
+	if !styled || fontPath == "" {
+		e.TextRect(r, strings.Join(plain, "\n"), font, size, color, align)
+		return
+	}
+
+	marks := map[core.Style]string{core.Bold: "**", core.Italic: "*", core.Bold | core.Italic: "***"}
+	var sb strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		for _, sp := range l {
+			text := strings.ReplaceAll(sp.Text, "*", "∗")
+			if word := strings.Trim(text, " "); marks[sp.Style] != "" && word != "" {
+				// Markup must hug the text, so spaces stay outside it.
+				lead := text[:strings.Index(text, word)]
+				trail := text[len(lead)+len(word):]
+				text = lead + marks[sp.Style] + word + marks[sp.Style] + trail
+			}
+			sb.WriteString(text)
+		}
+	}
+	fonts := fmt.Sprintf("regular=%s,bold=%s,italic=%s,bolditalic=%s,format", fontPath,
+		resolveStyledFont(font, core.Bold), resolveStyledFont(font, core.Italic),
+		resolveStyledFont(font, core.Bold|core.Italic))
+	e.truetype(r, fonts, sb.String(), size, color, align)
+}
+
+// Image draws an image file with FBInk's image mode. FBInk scales to the
+// given size and applies ordered dithering; the fit is worked out here.
+func (e execRenderer) Image(r Rect, path string) {
+	fit, ok := fitImage(path, r)
+	if !ok {
+		return
+	}
+	img := fmt.Sprintf("file=%s,x=%d,y=%d,w=%d,h=%d,dither", path, fit.X, fit.Y, fit.W, fit.H)
+	args := []string{"-g", img, "-b"}
+	if cfg.DarkMode {
+		args = append(args, "-H")
+	}
+	e.run(args)
+}
+
+func (execRenderer) Clear() {
+	args := []string{"-c"}
+	if cfg.DarkMode {
+		args = append(args, "-H")
+	}
+	exec.Command(fbinkPath, args...).Run()
+}
+
+func (execRenderer) Refresh() {
+	exec.Command(fbinkPath, "-s").Run()
+}
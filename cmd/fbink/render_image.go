@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"kobo-anki/core"
+	"os"
+	"path/filepath"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// imageRenderer rasterizes into an in-memory grayscale framebuffer instead
+// of the panel, so screens can be previewed and golden-tested off-device.
+type imageRenderer struct {
+	Img    *image.Gray
+	Dir    string // if set, each Refresh writes frame-NNN.png here
+	Frames int
+}
+
+func newImageRenderer(w, h int, dir string) *imageRenderer {
+	ir := &imageRenderer{
+		Img: image.NewGray(image.Rect(0, 0, w, h)),
+		Dir: dir,
+	}
+	ir.Clear()
+	return ir
+}
+
+// shade applies night mode the way FBInk's -H does: by inverting output.
+func shade(v uint8) color.Gray {
+	if cfg.DarkMode {
+		v = 0xFF - v
+	}
+	return color.Gray{v}
+}
+
+func (ir *imageRenderer) FillRect(r Rect, c string) {
+	rect := image.Rect(r.X, r.Y, r.X+r.W, r.Y+r.H)
+	draw.Draw(ir.Img, rect, image.NewUniform(shade(grayLevel(c, 0xFF))), image.Point{}, draw.Src)
+}
+
+func (ir *imageRenderer) TextRect(r Rect, text string, ft FontType, size int, c string, align Align) {
+	left, right := textMargins(r, align)
+	lines := wrapLines(plainLines(text), ft, size, screenW-left-right)
+	ir.StyledText(r, lines, ft, size, c, align)
+}
+
+func (ir *imageRenderer) StyledText(r Rect, lines []core.Line, ft FontType, size int, c string, align Align) {
+	face := fontFace(ft, size)
+	if face == nil {
+		return
+	}
+	left, right := textMargins(r, align)
+	maxW := screenW - left - right
+	m := face.Metrics()
+	y := r.Y + m.Ascent.Ceil()
+	d := font.Drawer{
+		Dst: ir.Img,
+		Src: image.NewUniform(shade(grayLevel(c, 0x00))),
+	}
+	for _, line := range lines {
+		x := left
+		if align == AlignCenter {
+			x += (maxW - lineWidth(line, ft, size)) / 2
+		}
+		d.Dot = fixed.P(x, y)
+		for _, sp := range line {
+			if d.Face = styledFace(ft, sp.Style, size); d.Face != nil {
+				d.DrawString(sp.Text)
+			}
+		}
+		y += m.Height.Ceil()
+	}
+}
+
+// grays16 is the panel's palette, for dithering images.
+var grays16 = func() color.Palette {
+	p := make(color.Palette, 16)
+	for i := range p {
+		p[i] = color.Gray{uint8(i * 0x11)}
+	}
+	return p
+}()
+
+// Image scales the image into place and dithers it to the 16 grays. This
+// uses error diffusion where FBInk dithers ordered, so the texture differs
+// slightly from the device but the gray levels match.
+func (ir *imageRenderer) Image(r Rect, path string) {
+	fit, ok := fitImage(path, r)
+	if !ok {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return
+	}
+	scaled := image.NewGray(image.Rect(0, 0, fit.W, fit.H))
+	draw.Draw(scaled, scaled.Bounds(), image.White, image.Point{}, draw.Src) // transparency on white
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), src, src.Bounds(), draw.Over, nil)
+	dithered := image.NewPaletted(scaled.Bounds(), grays16)
+	draw.FloydSteinberg.Draw(dithered, dithered.Bounds(), scaled, image.Point{})
+	for y := 0; y < fit.H; y++ {
+		for x := 0; x < fit.W; x++ {
+			ir.Img.SetGray(fit.X+x, fit.Y+y, shade(grays16[dithered.ColorIndexAt(x, y)].(color.Gray).Y))
+		}
+	}
+}
+
+func (ir *imageRenderer) Clear() {
+	draw.Draw(ir.Img, ir.Img.Bounds(), image.NewUniform(shade(0xFF)), image.Point{}, draw.Src)
+}
+
+func (ir *imageRenderer) Refresh() {
+	ir.Frames++
+	if ir.Dir == "" {
+		return
+	}
+	path := filepath.Join(ir.Dir, fmt.Sprintf("frame-%03d.png", ir.Frames))
+	if err := ir.WritePNG(path); err != nil {
+		fmt.Fprintf(os.Stderr, "image renderer: %v\n", err)
+	}
+}
+
+// WritePNG dumps the current framebuffer.
+func (ir *imageRenderer) WritePNG(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, ir.Img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"kobo-anki/core"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-spaced-repetition/go-fsrs/v3"
+)
+
+var update = flag.Bool("update", false, "rewrite golden images in testdata/")
+
+// setupImageScreen resets globals to a Clara BW sized screen with the image
+// renderer and a data dir holding two decks.
+func setupImageScreen(t *testing.T) *imageRenderer {
+	t.Helper()
+	screenW, screenH, screenDPI = 1072, 1448, 300
+	cfg.FontDir = ""
+	cfg.DarkMode = false
+	cfg.ButtonLayout, cfg.LeftHanded = layoutGrid, false
+	cfg.LayoutNav, cfg.LayoutAction = 8, 22
+	cfg.StatusBar, cfg.LowBattery = false, 5
+	cfg.Keys = nil
+	sysfsRoot = t.TempDir() // no battery unless a test adds one
+	computeLayout()
+	ir := newImageRenderer(screenW, screenH, "")
+	renderer = ir
+
+	dataDir = t.TempDir()
+	if err := core.CreateDeck(dataDir, "dutch", []core.Card{{Front: "hallo", Back: "hello"}, {Front: "fiets", Back: "bicycle"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.CreateDeck(dataDir, "german", nil); err != nil {
+		t.Fatal(err)
+	}
+	deckPage = 0
+	reverseMode = false
+	coreCfg.RequestRetention = 0.9
+	lastTouchTime = time.Time{}
+	currentDeck = "dutch"
+	currentCard = &core.Card{Front: "fiets", Back: "bicycle"}
+	cards = nil
+	session = core.Session{}
+	lastWake = time.Time{}
+	light = frontlight{}
+	return ir
+}
+
+// checkGolden compares img against testdata/<name>.png. Run
+// `go test ./cmd/fbink -update` after intentional UI changes.
+func checkGolden(t *testing.T, name string, img *image.Gray) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".png")
+	if *update {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("missing golden image (run with -update): %v", err)
+	}
+	defer f.Close()
+	want, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.Bounds() != img.Bounds() {
+		t.Fatalf("%s: size %v, want %v", name, img.Bounds(), want.Bounds())
+	}
+	diff := 0
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			r, _, _, _ := want.At(x, y).RGBA()
+			if uint8(r>>8) != img.GrayAt(x, y).Y {
+				diff++
+			}
+		}
+	}
+	if diff > 0 {
+		got := filepath.Join(t.TempDir(), name+".png")
+		(&imageRenderer{Img: img}).WritePNG(got)
+		t.Errorf("%s: %d pixels differ from golden; actual written to %s", name, diff, got)
+	}
+}
+
+func TestGoldenScreens(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		draw func()
+	}{
+		{"decks", drawDecksScreen},
+		{"front", drawFrontScreen},
+		{"back", drawBackScreen},
+		{"done", func() {
+			start := time.Now()
+			session = core.Session{Deck: "dutch", Start: start, Last: start.Add(12 * time.Minute),
+				Ratings: [5]int{0, 2, 1, 6, 3}, New: 4, Lapses: 1}
+			cards = []core.Card{{Front: "a", Due: time.Now().Add(5*time.Hour + time.Minute)}}
+			drawDoneScreen()
+		}},
+		{"actions", drawActionsScreen},
+		{"settings", func() { openSettings() }},
+		{"stats", func() {
+			now := time.Now()
+			core.SaveCards(core.DeckCSVPath(dataDir, "dutch"), []core.Card{
+				{Front: "a", State: fsrs.New},
+				{Front: "b", State: fsrs.Review, Due: now.AddDate(0, 0, 1), Reps: 4, Difficulty: 5, Lapses: 1},
+				{Front: "c", State: fsrs.Review, Due: now.AddDate(0, 0, 1), Reps: 2, Difficulty: 6},
+				{Front: "d", State: fsrs.Review, Due: now.AddDate(0, 0, 5), Reps: 7, Difficulty: 3},
+				{Front: "e", State: fsrs.Learning, Due: now.Add(-time.Hour), Reps: 1, Difficulty: 7},
+			})
+			openStats("dutch")
+		}},
+		{"sleep", drawSleepScreen},
+		{"front-status", func() {
+			cfg.StatusBar = true
+			writeBattery(t, 76, "Discharging")
+			saved := wallClock
+			defer func() { wallClock = saved }()
+			wallClock = func() time.Time { return time.Date(2025, 3, 1, 9, 41, 0, 0, time.Local) }
+			drawFrontScreen()
+		}},
+		{"low-battery", func() { drawLowBatteryScreen(battery{Percent: 4}) }},
+		{"decks-light", func() {
+			fakeFrontlight(t, 40, 3)
+			drawDecksScreen()
+		}},
+		{"back-light", func() {
+			fakeFrontlight(t, 40, 3)
+			os.MkdirAll(filepath.Join(dataDir, core.MediaDir), 0755)
+			os.WriteFile(filepath.Join(dataDir, core.MediaDir, "fiets.mp3"), nil, 0644)
+			currentCard = &core.Card{Front: "fiets [sound:fiets.mp3]", Back: "bicycle"}
+			drawBackScreen()
+		}},
+		{"light", func() {
+			fakeFrontlight(t, 40, 3)
+			drawLightScreen()
+		}},
+		{"back-row-left", func() {
+			cfg.ButtonLayout, cfg.LeftHanded = layoutRow, true
+			drawBackScreen()
+		}},
+		{"back-passfail", func() {
+			cfg.ButtonLayout, cfg.LayoutAction = layoutPassFail, 18
+			computeLayout()
+			drawBackScreen()
+		}},
+		{"back-long", func() {
+			currentCard = &core.Card{Front: "fiets", Back: longText}
+			drawBackScreen()
+		}},
+		{"front-image", func() {
+			writeTestImage(t, "fiets.png")
+			currentCard = &core.Card{Front: `<img src="fiets.png">de fiets`, Back: "bicycle"}
+			drawFrontScreen()
+		}},
+		{"back-sound", func() {
+			os.MkdirAll(filepath.Join(dataDir, core.MediaDir), 0755)
+			os.WriteFile(filepath.Join(dataDir, core.MediaDir, "fiets.mp3"), nil, 0644)
+			currentCard = &core.Card{Front: "fiets [sound:fiets.mp3]", Back: "bicycle"}
+			drawBackScreen()
+		}},
+		{"back-rich", func() {
+			currentCard = &core.Card{Front: "<b>de</b> fiets", Back: "a <i>bicycle</i><br>- **two** wheels<br>- pedals"}
+			drawBackScreen()
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ir := setupImageScreen(t)
+			tc.draw()
+			if ir.Frames != 1 {
+				t.Errorf("expected exactly one refresh, got %d", ir.Frames)
+			}
+			checkGolden(t, tc.name, ir.Img)
+		})
+	}
+}
+
+// writeTestImage puts a gradient with a dark disc, 400x300, in the media
+// folder.
+func writeTestImage(t *testing.T, name string) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			v := uint8(x * 255 / 399)
+			if dx, dy := x-200, y-150; dx*dx+dy*dy < 100*100 {
+				v /= 4
+			}
+			img.Set(x, y, color.RGBA{v, v, 255 - v, 255})
+		}
+	}
+	dir := filepath.Join(dataDir, core.MediaDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackScreenTargets(t *testing.T) {
+	setupImageScreen(t)
+	drawBackScreen()
+	for _, id := range []string{"back", "again", "hard", "good", "easy"} {
+		found := false
+		for _, el := range scene {
+			if el.ID == id {
+				found = true
+				cx, cy := el.Rect.X+el.Rect.W/2, el.Rect.Y+el.Rect.H/2
+				if got := sceneHitTest(cx, cy); got != id {
+					t.Errorf("tap at center of %q hit %q", id, got)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no touch target %q on back screen", id)
+		}
+	}
+}
+
+// longText overflows the answer area even at size_min.
+var longText = strings.Repeat("A two-wheeled vehicle that is propelled by pedals and steered with handlebars. ", 12)
+
+func TestLayoutText(t *testing.T) {
+	setupImageScreen(t)
+	short := layoutText(plainLines("bicycle"), FontBack, 28, 16, 900, 800)
+	if short.Size != 28 || len(short.Pages) != 1 || len(short.Pages[0]) != 1 {
+		t.Errorf("short text: %+v", short)
+	}
+	medium := strings.Repeat("a fairly long definition ", 8)
+	shrunk := layoutText(plainLines(medium), FontBack, 28, 16, 900, 800)
+	if shrunk.Size >= 28 || shrunk.Size < 16 || len(shrunk.Pages) != 1 {
+		t.Errorf("medium text should shrink onto one page: size %d, %d pages", shrunk.Size, len(shrunk.Pages))
+	}
+	paged := layoutText(plainLines(longText), FontBack, 28, 12, 900, 800)
+	if paged.Size != 12 || len(paged.Pages) < 2 {
+		t.Errorf("long text should page at the minimum size: size %d, %d pages", paged.Size, len(paged.Pages))
+	}
+	for _, line := range wrapLines(plainLines(strings.Repeat("x", 200)), FontBack, 28, 900) {
+		if w := lineWidth(line, FontBack, 28); w > 900 {
+			t.Errorf("unbreakable word overflowed: line is %dpx", w)
+		}
+	}
+	// Styles survive wrapping, including a word split across two styles.
+	rich := core.Line{{Text: "a "}, {Text: "bi", Style: core.Bold}, {Text: "cycle " + strings.Repeat("word ", 40)}}
+	wrapped := wrapLines([]core.Line{rich}, FontBack, 28, 900)
+	if len(wrapped) < 2 || len(wrapped[0]) < 3 || wrapped[0][1] != (core.Span{Text: "bi", Style: core.Bold}) {
+		t.Errorf("styled wrap: %q", wrapped)
+	}
+	for _, line := range wrapped {
+		if w := lineWidth(line, FontBack, 28); w > 900 {
+			t.Errorf("styled line overflowed: %dpx", w)
+		}
+	}
+}
+
+func TestCardPaging(t *testing.T) {
+	setupImageScreen(t)
+	defer func() { input = nil }()
+	core.SaveCards(core.DeckCSVPath(dataDir, "dutch"), []core.Card{{Front: "fiets", Back: longText}})
+	// Open the deck, show the answer and page forward twice.
+	input = newStdinInput(strings.NewReader("1\nenter\nswipe up\nswipe up\n"))
+	run()
+	if cardPage != 2 {
+		t.Fatalf("cardPage = %d after two page turns, want 2", cardPage)
+	}
+	found := false
+	for _, el := range scene {
+		found = found || el.ID == "page-prev"
+	}
+	if !found {
+		t.Fatal("no page-prev button after paging forward")
+	}
+}
+
+func TestDirtyRect(t *testing.T) {
+	a := image.NewGray(image.Rect(0, 0, 100, 100))
+	b := image.NewGray(image.Rect(0, 0, 100, 100))
+	if r := dirtyRect(a, b); !r.Empty() {
+		t.Fatalf("identical frames: dirty %v", r)
+	}
+	a.Pix[a.PixOffset(10, 20)] = 1
+	a.Pix[a.PixOffset(40, 30)] = 1
+	if r, want := dirtyRect(a, b), image.Rect(10, 20, 41, 31); r != want {
+		t.Fatalf("dirty %v, want %v", r, want)
+	}
+	if r := dirtyRect(a, nil); r != a.Bounds() {
+		t.Fatalf("unknown previous frame: dirty %v, want full screen", r)
+	}
+}
+
+// TestBatchRendererSingleInvocation checks a whole screen costs one fbink
+// process, and an unchanged redraw costs none.
+func TestBatchRendererSingleInvocation(t *testing.T) {
+	setupImageScreen(t)
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls")
+	fbinkPath = filepath.Join(dir, "fbink")
+	script := "#!/bin/sh\necho \"$@\" >> " + logPath + "\n"
+	if err := os.WriteFile(fbinkPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { fbinkPath = "fbink" }()
+
+	br := newBatchRenderer(screenW, screenH)
+	br.tmpPath = filepath.Join(dir, "frame.png")
+	renderer = br
+
+	drawDecksScreen()
+	drawDecksScreen()
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 1 {
+		t.Fatalf("expected 1 fbink call for two identical frames, got %d:\n%s", n, data)
+	}
+	if !bytes.HasPrefix(data, []byte("-g file=")) {
+		t.Fatalf("unexpected fbink args: %s", data)
+	}
+}
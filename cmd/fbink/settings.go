@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"kobo-anki/core"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Settings screen
+// ============================================================
+
+// setting is one row of the settings screen. Steppers get -/+ buttons
+// (IDs set-<key>-dec and set-<key>-inc), toggles one button (set-<key>).
+type setting struct {
+	Label  string
+	Key    string        // config key the value is saved under
+	Core   bool          // key lives in anki-core.conf, not anki-fbink.conf
+	Show   func() string // value as shown on screen
+	Conf   func() string // value as written to the config file
+	Step   func(dir int) // dir is -1 or +1; toggles ignore it
+	Toggle bool
+}
+
+var (
+	settingFonts []string          // TTF/OTF files in font_dir, listed on opening
+	settingSaved map[string]string // config values when the screen opened
+)
+
+func settings() []setting {
+	onOff := func(b bool) string {
+		if b {
+			return "On"
+		}
+		return "Off"
+	}
+	font := func(name *string) func(int) {
+		return func(dir int) {
+			if len(settingFonts) == 0 {
+				return
+			}
+			i := sort.SearchStrings(settingFonts, *name)
+			if i < len(settingFonts) && settingFonts[i] == *name {
+				i += dir
+			} else if dir < 0 {
+				i--
+			}
+			*name = settingFonts[(i+len(settingFonts))%len(settingFonts)]
+		}
+	}
+	fontName := func(name *string) func() string {
+		return func() string {
+			if *name == "" {
+				return "Default"
+			}
+			return strings.TrimSuffix(*name, filepath.Ext(*name))
+		}
+	}
+	return []setting{
+		{Label: "Card text size", Key: "size_card",
+			Show: func() string { return strconv.Itoa(cfg.SizeCard) },
+			Conf: func() string { return strconv.Itoa(cfg.SizeCard) },
+			Step: func(dir int) { cfg.SizeCard = min(max(cfg.SizeCard+2*dir, 12), 72) }},
+		{Label: "Front font", Key: "font_front",
+			Show: fontName(&cfg.FontFront),
+			Conf: func() string { return cfg.FontFront },
+			Step: font(&cfg.FontFront)},
+		{Label: "Back font", Key: "font_back",
+			Show: fontName(&cfg.FontBack),
+			Conf: func() string { return cfg.FontBack },
+			Step: font(&cfg.FontBack)},
+		{Label: "Dark mode", Key: "darkmode", Toggle: true,
+			Show: func() string { return onOff(cfg.DarkMode) },
+			Conf: func() string { return strconv.FormatBool(cfg.DarkMode) },
+			Step: func(int) { cfg.DarkMode = !cfg.DarkMode }},
+		{Label: "Reverse cards", Key: "reverse", Core: true, Toggle: true,
+			Show: func() string { return onOff(reverseMode) },
+			Conf: func() string { return strconv.FormatBool(reverseMode) },
+			Step: func(int) { reverseMode = !reverseMode }},
+		{Label: "Retention", Key: "request_retention", Core: true,
+			Show: func() string { return fmt.Sprintf("%.0f%%", coreCfg.RequestRetention*100) },
+			Conf: func() string { return strconv.FormatFloat(coreCfg.RequestRetention, 'f', 2, 64) },
+			Step: func(dir int) {
+				r := float64(int(coreCfg.RequestRetention*100+0.5)+dir) / 100
+				coreCfg.RequestRetention = min(max(r, 0.70), 0.99)
+				core.InitScheduler(coreCfg.RequestRetention, coreCfg.MaximumInterval, coreCfg.EnableShortTerm)
+			}},
+		{Label: "Tap cooldown", Key: "touch_cooldown",
+			Show: func() string { return fmt.Sprintf("%d ms", touchCooldown.Milliseconds()) },
+			Conf: func() string { return strconv.FormatInt(touchCooldown.Milliseconds(), 10) },
+			Step: func(dir int) {
+				touchCooldown = min(max(touchCooldown+time.Duration(dir)*50*time.Millisecond, 0), 1000*time.Millisecond)
+			}},
+	}
+}
+
+// listFonts returns the font files in dir, sorted.
+func listFonts(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if dir == "" || err != nil {
+		return nil
+	}
+	var fonts []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if !e.IsDir() && (ext == ".ttf" || ext == ".otf") {
+			fonts = append(fonts, e.Name())
+		}
+	}
+	sort.Strings(fonts)
+	return fonts
+}
+
+func openSettings() Screen {
+	settingFonts = listFonts(cfg.FontDir)
+	settingSaved = map[string]string{}
+	for _, s := range settings() {
+		settingSaved[s.Key] = s.Conf()
+	}
+	drawSettingsScreen()
+	return ScreenSettings
+}
+
+// changeSetting applies a set-* button press.
+func changeSetting(id string) {
+	for _, s := range settings() {
+		switch id {
+		case "set-" + s.Key, "set-" + s.Key + "-inc":
+			s.Step(1)
+		case "set-" + s.Key + "-dec":
+			s.Step(-1)
+		}
+	}
+}
+
+// saveSettings writes the settings changed since openSettings back to
+// anki-fbink.conf and anki-core.conf, keeping the rest of each file.
+func saveSettings() error {
+	fbinkValues, coreValues := map[string]string{}, map[string]string{}
+	for _, s := range settings() {
+		if v := s.Conf(); v != settingSaved[s.Key] {
+			if s.Core {
+				coreValues[s.Key] = v
+			} else {
+				fbinkValues[s.Key] = v
+			}
+		}
+	}
+	if len(fbinkValues) > 0 {
+		if err := updateConfigFile(configPath, fbinkValues); err != nil {
+			return err
+		}
+	}
+	if len(coreValues) > 0 {
+		return updateConfigFile(coreConfigPath, coreValues)
+	}
+	return nil
+}
+
+func drawSettingsScreen() {
+	sceneClear()
+	renderer.Clear()
+
+	gap := screenW / 30
+	drawLabel(vcenter(navRect, cfg.SizeTitle*3/4), "Settings", FontMenu, cfg.SizeTitle*3/4, "")
+
+	rows := splitV(inset(contentRect, gap/2), len(settings()), gap/2)
+	size := cfg.SizeMenu * 3 / 4
+	for i, s := range settings() {
+		r := rows[i]
+		labelRect := Rect{r.X + gap/2, r.Y, r.W * 2 / 5, r.H}
+		renderer.TextRect(vcenter(labelRect, size), s.Label, FontMenu, size, "", AlignLeft)
+
+		ctrl := Rect{r.X + r.W*2/5, r.Y, r.W * 3 / 5, r.H}
+		if s.Toggle {
+			drawButton("set-"+s.Key, Rect{ctrl.X + ctrl.W/3, ctrl.Y, ctrl.W * 2 / 3, ctrl.H}, s.Show(), FontMenu, size)
+			continue
+		}
+		cols := splitH(ctrl, 4, gap/2)
+		valueRect := Rect{cols[1].X, r.Y, cols[2].X + cols[2].W - cols[1].X, r.H}
+		drawFittedLines(vcenter(valueRect, size), plainLines(s.Show()), FontMenu, size, "")
+		dec, inc := "-", "+"
+		if strings.HasPrefix(s.Key, "font_") {
+			dec, inc = "<", ">"
+			if len(settingFonts) == 0 {
+				drawButtonDisabled(cols[0], dec, FontMenu, size)
+				drawButtonDisabled(cols[3], inc, FontMenu, size)
+				continue
+			}
+		}
+		drawButton("set-"+s.Key+"-dec", cols[0], dec, FontMenu, size)
+		drawButton("set-"+s.Key+"-inc", cols[3], inc, FontMenu, size)
+	}
+
+	// Full width, so it can be hit even when taps land mirrored left to right.
+	actions := splitV(inset(actionRect, gap/2), 2, gap)
+	drawButton("calibrate", actions[0], "Calibrate touch", FontMenu, cfg.SizeMenu/2)
+	drawButton("back", actions[1], "Done", FontMenu, cfg.SizeMenu/2)
+
+	renderer.Refresh()
+	drainInput()
+}
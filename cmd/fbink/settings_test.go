@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sceneCenter returns "tap X Y" for the middle of a scene element.
+func sceneCenter(t *testing.T, id string) string {
+	t.Helper()
+	for _, el := range scene {
+		if el.ID == id {
+			return fmt.Sprintf("tap %d %d", el.Rect.X+el.Rect.W/2, el.Rect.Y+el.Rect.H/2)
+		}
+	}
+	t.Fatalf("no %q on screen", id)
+	return ""
+}
+
+func TestSettingsSaved(t *testing.T) {
+	setupImageScreen(t)
+	dir := t.TempDir()
+	configPath = filepath.Join(dir, "anki-fbink.conf")
+	coreConfigPath = filepath.Join(dir, "anki-core.conf")
+	cfg.FontDir = filepath.Join(dir, "fonts")
+	os.Mkdir(cfg.FontDir, 0755)
+	for _, f := range []string{"B.ttf", "A.ttf", "notes.txt", "C.otf"} {
+		os.WriteFile(filepath.Join(cfg.FontDir, f), nil, 0644)
+	}
+	os.WriteFile(configPath, []byte("# card text\nsize_card=28\ndarkmode=false\n"), 0644)
+	os.WriteFile(coreConfigPath, []byte("# shared\ndata_dir=words\nrequest_retention=0.9\n"), 0644)
+	saved := cfg
+	defer func() {
+		cfg, input, touchCooldown, reverseMode = saved, nil, 300*time.Millisecond, false
+		configPath, coreConfigPath = "./anki-fbink.conf", "anki-core.conf"
+	}()
+
+	openSettings()
+	script := []string{"s"}
+	for _, id := range []string{"set-size_card-inc", "set-size_card-inc", "set-font_back-inc", "set-font_back-inc",
+		"set-darkmode", "set-darkmode", "set-reverse", "set-request_retention-dec"} {
+		script = append(script, sceneCenter(t, id))
+	}
+	script = append(script, "back")
+	input = newStdinInput(strings.NewReader(strings.Join(script, "\n") + "\n"))
+	run()
+
+	data, _ := os.ReadFile(configPath)
+	if want := "# card text\nsize_card=32\ndarkmode=false\nfont_back=B.ttf\n"; string(data) != want {
+		t.Errorf("anki-fbink.conf:\n%s\nwant:\n%s", data, want)
+	}
+	data, _ = os.ReadFile(coreConfigPath)
+	if want := "# shared\ndata_dir=words\nrequest_retention=0.89\nreverse=true\n"; string(data) != want {
+		t.Errorf("anki-core.conf:\n%s\nwant:\n%s", data, want)
+	}
+}
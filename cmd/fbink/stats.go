@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"kobo-anki/core"
+	"strconv"
+	"time"
+)
+
+// ============================================================
+// Deck stats screen
+// ============================================================
+
+// forecastDays is how far ahead the stats chart looks.
+const forecastDays = 14
+
+// statsDeck is the deck on the stats screen.
+var statsDeck core.DeckName
+
+func openStats(deck core.DeckName) Screen {
+	statsDeck = deck
+	drawStatsScreen()
+	return ScreenStats
+}
+
+func drawStatsScreen() {
+	sceneClear()
+	renderer.Clear()
+
+	gap := screenW / 30
+	btnH := backButtonH(gap)
+	backRect := Rect{gap / 2, gap / 2, screenW - gap, btnH}
+	drawButton("back", backRect, "Back", FontMenu, cfg.SizeMenu/2)
+
+	c, _ := core.LoadCards(core.DeckCSVPath(dataDir, statsDeck))
+	st := core.Stats(c, time.Now(), forecastDays)
+
+	titleRect := Rect{contentRect.X, backRect.Y + backRect.H + gap, contentRect.W, contentRect.H / 10}
+	drawFittedLines(titleRect, plainLines(string(statsDeck)), FontMenu, cfg.SizeTitle*3/4, "")
+
+	// Counts: label on the left, value on the right
+	rows := []struct {
+		label string
+		value string
+	}{
+		{"Total", strconv.Itoa(st.Total)},
+		{"New", strconv.Itoa(st.New)},
+		{"Learning", strconv.Itoa(st.Learning)},
+		{"Review", strconv.Itoa(st.Review)},
+		{"Due today", strconv.Itoa(st.DueToday)},
+		{"Due tomorrow", strconv.Itoa(st.DueTomorrow)},
+		{"Avg. difficulty", fmt.Sprintf("%.1f", st.AvgDifficulty)},
+		{"Lapses", strconv.Itoa(st.Lapses)},
+	}
+	size := cfg.SizeMenu * 3 / 4
+	rowH := screenH * 45 / 1000
+	top := titleRect.Y + titleRect.H
+	for i, row := range rows {
+		r := Rect{contentRect.X + screenW/10, top + i*rowH, contentRect.W - screenW/5, rowH}
+		renderer.TextRect(vcenter(r, size), row.label, FontMenu, size, "", AlignLeft)
+		renderer.TextRect(vcenter(r, size), row.value, FontMenu, size, "", AlignRight)
+	}
+
+	chartTop := top + len(rows)*rowH + gap
+	chart := Rect{contentRect.X + screenW/10, chartTop, contentRect.W - screenW/5, contentRect.Y + contentRect.H - chartTop}
+	drawForecast(chart, st.Forecast)
+
+	study := splitV(inset(actionRect, gap/2), 2, gap)[1]
+	drawButton("study", study, "Study", FontMenu, cfg.SizeMenu/2)
+
+	drawStatusBar()
+	renderer.Refresh()
+	drainInput()
+}
+
+// drawForecast draws a bar per day of counts in r, today first, with a
+// title above and day labels below.
+func drawForecast(r Rect, counts []int) {
+	small := cfg.SizeMenu / 2
+	labelH := small * 5
+	drawLabel(Rect{r.X, r.Y, r.W, labelH}, fmt.Sprintf("Due in the next %d days", len(counts)), FontMenu, small, "GRAY8")
+
+	plot := Rect{r.X, r.Y + 2*labelH, r.W, r.H - 3*labelH}
+	cols := splitH(plot, len(counts), max(plot.W/len(counts)/5, 1))
+	peak := 1
+	for _, n := range counts {
+		peak = max(peak, n)
+	}
+	for i, col := range cols {
+		if counts[i] == 0 {
+			continue
+		}
+		h := max(col.H*counts[i]/peak, 2)
+		color := "GRAY8"
+		if i == 0 {
+			color = "BLACK"
+		}
+		renderer.FillRect(Rect{col.X, col.Y + col.H - h, col.W, h}, color)
+		drawLabel(Rect{col.X - col.W/2, col.Y + col.H - h - labelH, 2 * col.W, labelH}, strconv.Itoa(counts[i]), FontMenu, small, "")
+	}
+	renderer.FillRect(Rect{plot.X, plot.Y + plot.H, plot.W, 2}, "BLACK")
+
+	// Day labels centered under the first and last bars
+	first, last := cols[0], cols[len(cols)-1]
+	y := plot.Y + plot.H + labelH/4
+	drawLabel(Rect{first.X - first.W, y, 3 * first.W, labelH}, "today", FontMenu, small, "GRAY8")
+	drawLabel(Rect{last.X - last.W, y, 3 * last.W, labelH}, fmt.Sprintf("+%d", len(counts)-1), FontMenu, small, "GRAY8")
+}
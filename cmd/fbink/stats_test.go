@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatsNavigation(t *testing.T) {
+	setupImageScreen(t)
+	defer func() { input = nil }()
+	drawDecksScreen()
+	longPress := strings.Replace(sceneCenter(t, "deck-1"), "tap", "longpress", 1)
+	info := sceneCenter(t, "stats-0")
+
+	// Long-press opens the second deck's stats.
+	input = newStdinInput(strings.NewReader(longPress + "\n"))
+	run()
+	if statsDeck != "german" || sceneHitTest(screenW/2, screenH-screenH/20) != "study" {
+		t.Fatalf("long-press on german: stats for %q", statsDeck)
+	}
+
+	// The info button opens the first deck's stats, and Study opens it.
+	input = newStdinInput(strings.NewReader(info + "\nenter\n"))
+	run()
+	if statsDeck != "dutch" || currentDeck != "dutch" || currentCard == nil {
+		t.Fatalf("info then study: stats %q, deck %q, card %v", statsDeck, currentDeck, currentCard)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"kobo-anki/core"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Status bar: clock and battery, which Nickel showed until start.sh
+// stopped it
+// ============================================================
+
+// wallClock is the time the status bar shows; tests fix it.
+var wallClock = time.Now
+
+type battery struct {
+	Percent  int
+	Charging bool // on external power, charging or full
+}
+
+// readBattery reads the battery from sysfsRoot/class/power_supply. The
+// supply whose type is Battery wins; without type files, the first one
+// with a capacity. false if there is no battery to read.
+func readBattery() (battery, bool) {
+	dirs, _ := filepath.Glob(filepath.Join(sysfsRoot, "class", "power_supply", "*"))
+	var found string
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, "capacity")); err != nil {
+			continue
+		}
+		if readSysfs(filepath.Join(dir, "type")) == "Battery" {
+			found = dir
+			break
+		}
+		if found == "" {
+			found = dir
+		}
+	}
+	if found == "" {
+		return battery{}, false
+	}
+	pct, err := strconv.Atoi(readSysfs(filepath.Join(found, "capacity")))
+	if err != nil {
+		return battery{}, false
+	}
+	status := readSysfs(filepath.Join(found, "status"))
+	return battery{Percent: pct, Charging: status == "Charging" || status == "Full"}, true
+}
+
+// readSysfs returns a sysfs attribute without its trailing newline, or "".
+func readSysfs(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// statusInterval is how often run checks the battery and the clock while
+// no input arrives.
+const statusInterval = 20 * time.Second
+
+// statusShown is the text drawStatusBar last drew, so refreshStatusBar
+// only touches the panel when the minute or the battery changed.
+var statusShown [2]string
+
+// statusBarRect is the strip between the top buttons and the bottom of
+// navRect.
+func statusBarRect() Rect {
+	gap := screenW / 30
+	top := gap/2 + backButtonH(gap)
+	return Rect{gap, top, screenW - 2*gap, navRect.Y + navRect.H - top}
+}
+
+// statusText returns the clock and battery text of the status bar.
+func statusText() [2]string {
+	text := [2]string{wallClock().Format("15:04"), ""}
+	if b, ok := readBattery(); ok {
+		text[1] = fmt.Sprintf("%d%%", b.Percent)
+		if b.Charging {
+			text[1] += " charging"
+		}
+	}
+	return text
+}
+
+// statusSize is the text size of the status bar.
+func statusSize() int {
+	return max(cfg.SizeMenu*3/8, 4)
+}
+
+// drawStatusBar puts the time on the left and the battery on the right of
+// the status bar strip.
+func drawStatusBar() {
+	if !cfg.StatusBar {
+		return
+	}
+	r := statusBarRect()
+	size := statusSize()
+	if r.H < size {
+		return
+	}
+	statusShown = statusText()
+	renderer.TextRect(vcenter(r, size), statusShown[0], FontMenu, size, "GRAY8", AlignLeft)
+	if statusShown[1] != "" {
+		renderer.TextRect(vcenter(r, size), statusShown[1], FontMenu, size, "GRAY8", AlignRight)
+	}
+}
+
+// statusBoxes returns the boxes drawStatusBar's clock and battery text
+// cover, wide enough for either text, descenders included.
+func statusBoxes(text, other [2]string) [2]Rect {
+	r := vcenter(statusBarRect(), statusSize())
+	h := r.H
+	if face := fontFace(FontMenu, statusSize()); face != nil {
+		m := face.Metrics()
+		h = (m.Ascent + m.Descent).Ceil()
+	}
+	var boxes [2]Rect
+	for i, align := range []Align{AlignLeft, AlignRight} {
+		left, _ := textMargins(r, align)
+		w := max(lineWidth(core.Line{{Text: text[i]}}, FontMenu, statusSize()),
+			lineWidth(core.Line{{Text: other[i]}}, FontMenu, statusSize()))
+		boxes[i] = Rect{left, r.Y, w + statusSize()/4, h}
+	}
+	return boxes
+}
+
+// refreshStatusBar redraws the status bar text of screen if it changed
+// since it was drawn, clearing only the boxes the old and new text cover.
+// The decks screen's title shares the strip, so it is redrawn whole. The
+// settings and light screens have no status bar.
+func refreshStatusBar(screen Screen) {
+	if !cfg.StatusBar || screen == ScreenSettings || screen == ScreenLight {
+		return
+	}
+	text := statusText()
+	if text == statusShown {
+		return
+	}
+	if screen == ScreenDecks {
+		redrawScreen(screen)
+		return
+	}
+	for _, box := range statusBoxes(statusShown, text) {
+		renderer.FillRect(box, "WHITE")
+	}
+	drawStatusBar()
+	renderer.Refresh()
+}
+
+// lowBattery reports whether the battery is at or below the low_battery
+// threshold and not charging.
+func lowBattery() (battery, bool) {
+	b, ok := readBattery()
+	return b, ok && cfg.LowBattery > 0 && !b.Charging && b.Percent <= cfg.LowBattery
+}
+
+// drawLowBatteryScreen is left on the panel when the app exits because the
+// battery is nearly empty.
+func drawLowBatteryScreen(b battery) {
+	sceneClear()
+	renderer.Clear()
+	drawLabel(Rect{contentRect.X, screenH / 4, contentRect.W, screenH / 8}, "Battery low", FontMenu, cfg.SizeTitle, "")
+	drawLabel(Rect{contentRect.X, screenH * 3 / 8, contentRect.W, screenH / 8}, fmt.Sprintf("%d%%", b.Percent), FontMenu, cfg.SizeCard, "")
+	drawLabel(Rect{contentRect.X, screenH / 2, contentRect.W, screenH / 12}, "Your progress is saved. Charge the Kobo to keep studying.", FontMenu, cfg.SizeMenu/2, "GRAY8")
+	renderer.Refresh()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeBattery adds a battery to the fake sysfsRoot.
+func writeBattery(t *testing.T, percent int, status string) {
+	t.Helper()
+	dir := filepath.Join(sysfsRoot, "class", "power_supply", "battery")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{"capacity": strconv.Itoa(percent), "status": status, "type": "Battery"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadBattery(t *testing.T) {
+	setupImageScreen(t)
+	if _, ok := readBattery(); ok {
+		t.Fatal("battery found in an empty sysfs")
+	}
+
+	// A charger that reports a capacity too must not be mistaken for the
+	// battery.
+	usb := filepath.Join(sysfsRoot, "class", "power_supply", "a-usb")
+	os.MkdirAll(usb, 0755)
+	os.WriteFile(filepath.Join(usb, "capacity"), []byte("100\n"), 0644)
+	os.WriteFile(filepath.Join(usb, "type"), []byte("USB\n"), 0644)
+	writeBattery(t, 42, "Charging")
+
+	b, ok := readBattery()
+	if !ok || b.Percent != 42 || !b.Charging {
+		t.Fatalf("readBattery = %+v, %v; want 42%% charging", b, ok)
+	}
+	if _, low := lowBattery(); low {
+		t.Error("42% reported as low")
+	}
+	writeBattery(t, 5, "Charging")
+	if _, low := lowBattery(); low {
+		t.Error("low battery reported while charging")
+	}
+	writeBattery(t, 5, "Discharging")
+	if _, low := lowBattery(); !low {
+		t.Error("5% discharging not reported as low")
+	}
+}
+
+// TestLowBatteryExit checks that a study session ends on the warning
+// screen once the battery runs low, with the rating already saved.
+func TestLowBatteryExit(t *testing.T) {
+	ir := setupImageScreen(t)
+	defer func() { input = nil }()
+	writeBattery(t, 30, "Discharging")
+
+	input = &hookInput{
+		src: newStdinInput(strings.NewReader("1\nenter\n3\nenter\n3\n")),
+		// The battery drops once the first card is rated.
+		hook: func(n int) {
+			if n == 3 {
+				writeBattery(t, 4, "Discharging")
+			}
+		},
+	}
+	run()
+
+	if n := reviewedCount(t); n != 1 {
+		t.Fatalf("reviewed %d cards, want 1", n)
+	}
+	if _, err := input.Next(); err != nil {
+		t.Fatalf("app kept reading input after the battery ran low: %v", err)
+	}
+	checkGolden(t, "low-battery", ir.Img) // same screen as the golden test draws
+}
+
+// TestIdleLowBattery checks that the battery is checked on ticks too, so
+// an untouched device still exits when it runs low.
+func TestIdleLowBattery(t *testing.T) {
+	ir := setupImageScreen(t)
+	defer func() { input = nil }()
+	writeBattery(t, 30, "Discharging")
+
+	input = &hookInput{
+		src: &scriptInput{evs: []Event{{Kind: EventKey, Key: "1"}, {Kind: EventTick}, {Kind: EventTick}}},
+		hook: func(n int) {
+			if n == 2 {
+				writeBattery(t, 4, "Discharging")
+			}
+		},
+	}
+	run()
+
+	if ev, err := input.Next(); err != nil || ev.Kind != EventTick {
+		t.Fatalf("app did not exit on the first tick after the battery ran low: %+v, %v", ev, err)
+	}
+	checkGolden(t, "low-battery", ir.Img)
+}
+
+// TestStatusBarTicks checks that ticks redraw the clock when the minute
+// changes, and leave the panel alone otherwise.
+func TestStatusBarTicks(t *testing.T) {
+	ir := setupImageScreen(t)
+	defer func() { input = nil }()
+	cfg.StatusBar = true
+	writeBattery(t, 76, "Discharging")
+	saved := wallClock
+	defer func() { wallClock = saved }()
+	now := time.Date(2025, 3, 1, 9, 41, 0, 0, time.Local)
+	wallClock = func() time.Time { return now }
+
+	tick := Event{Kind: EventTick}
+	input = &hookInput{
+		src: &scriptInput{evs: []Event{{Kind: EventKey, Key: "1"}, tick, tick, tick}},
+		hook: func(n int) {
+			if n == 3 {
+				now = now.Add(time.Minute)
+			}
+		},
+	}
+	run()
+
+	// decks, front, then one redraw for the minute that passed
+	if ir.Frames != 3 {
+		t.Errorf("%d frames drawn, want 3", ir.Frames)
+	}
+	if statusShown[0] != "09:42" {
+		t.Errorf("status bar shows %q, want 09:42", statusShown[0])
+	}
+}
+
+// TestStatusBarRefresh checks that a tick's refresh leaves each screen as
+// a full redraw at the new time would, without erasing what shares the
+// strip with the status bar.
+func TestStatusBarRefresh(t *testing.T) {
+	saved := wallClock
+	defer func() { wallClock = saved }()
+	for _, tc := range []struct {
+		name   string
+		screen Screen
+		draw   func()
+	}{
+		{"decks", ScreenDecks, drawDecksScreen},
+		{"front", ScreenFront, drawFrontScreen},
+		{"back", ScreenBack, drawBackScreen},
+		{"done", ScreenDone, drawDoneScreen},
+		{"actions", ScreenActions, drawActionsScreen},
+		{"stats", ScreenStats, func() { openStats("dutch") }},
+	} {
+		ir := setupImageScreen(t)
+		cfg.StatusBar = true
+		writeBattery(t, 76, "Discharging")
+		now := time.Date(2025, 3, 1, 9, 41, 0, 0, time.Local)
+		wallClock = func() time.Time { return now }
+		tc.draw()
+		now = now.Add(time.Minute)
+		writeBattery(t, 100, "Charging")
+		refreshStatusBar(tc.screen)
+		got := append([]byte(nil), ir.Img.Pix...)
+
+		ir.Clear()
+		tc.draw()
+		if n := diffPixels(got, ir.Img.Pix); n != 0 {
+			t.Errorf("%s: refresh differs from a full redraw by %d px", tc.name, n)
+		}
+	}
+}
+
+func diffPixels(a, b []byte) int {
+	n := 0
+	for i := range a {
+		if a[i] != b[i] {
+			n++
+		}
+	}
+	return n
+}
+
+// scriptInput returns evs in turn, then io.EOF.
+type scriptInput struct{ evs []Event }
+
+func (s *scriptInput) Next() (Event, error) {
+	if len(s.evs) == 0 {
+		return Event{}, io.EOF
+	}
+	ev := s.evs[0]
+	s.evs = s.evs[1:]
+	return ev, nil
+}
+
+func (s *scriptInput) Drain() {}
+
+// hookInput calls hook with the number of each event after delivering it.
+type hookInput struct {
+	src  InputSource
+	hook func(n int)
+	n    int
+}
+
+func (h *hookInput) Next() (Event, error) {
+	ev, err := h.src.Next()
+	if err == nil {
+		h.n++
+		h.hook(h.n)
+	}
+	return ev, err
+}
+
+func (h *hookInput) Drain() { h.src.Drain() }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const tokenCookie = "kobo_anki_token"
+
+func secretEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authMiddleware enforces the optional token and basic-auth credentials.
+// The token may come from a "token" query parameter (which also sets a
+// cookie, so the Kobo browser only needs the link once), the cookie, or an
+// "Authorization: Bearer" header.
+func authMiddleware(cfg serverConfig, next http.Handler) http.Handler {
+	if cfg.Token == "" && cfg.User == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Launcher scripts poll the health check without credentials.
+		if r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if cfg.User != "" {
+			user, pass, ok := r.BasicAuth()
+			if !ok || !secretEqual(user, cfg.User) || !secretEqual(pass, cfg.Password) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="kobo-anki"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if cfg.Token != "" {
+			if t := r.URL.Query().Get("token"); t != "" && secretEqual(t, cfg.Token) {
+				http.SetCookie(w, &http.Cookie{
+					Name:     tokenCookie,
+					Value:    t,
+					Path:     "/",
+					HttpOnly: true,
+					SameSite: http.SameSiteStrictMode,
+				})
+				q := r.URL.Query()
+				q.Del("token")
+				u := *r.URL
+				u.RawQuery = q.Encode()
+				http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+				return
+			}
+			ok := false
+			if c, err := r.Cookie(tokenCookie); err == nil && secretEqual(c.Value, cfg.Token) {
+				ok = true
+			}
+			if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") && secretEqual(strings.TrimPrefix(h, "Bearer "), cfg.Token) {
+				ok = true
+			}
+			if !ok {
+				http.Error(w, "forbidden: open the server URL with ?token=...", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writable wraps handlers that modify decks so read-only mode can refuse them.
+func writable(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if srvCfg.ReadOnly {
+			http.Error(w, "server is in read-only mode", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// ensureCert generates a self-signed certificate and key on first run.
+// Existing files are left alone so users can drop in their own.
+func ensureCert(certPath, keyPath, host string) error {
+	if _, err := os.Stat(certPath); err == nil {
+		if _, err := os.Stat(keyPath); err == nil {
+			return nil
+		}
+	}
+	log.Printf("Generating self-signed certificate %s", certPath)
+
+	// RSA rather than ECDSA: older Kobo browser builds lack EC cipher suites.
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return err
+	}
+	tmpl := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "kobo-anki"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() && !ip.IsLoopback() {
+		tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+	} else if host != "" && ip == nil && host != "localhost" {
+		tmpl.DNSNames = append(tmpl.DNSNames, host)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(certPath, "CERTIFICATE", der, 0644); err != nil {
+		return err
+	}
+	return writePEM(keyPath, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), 0600)
+}
+
+func writePEM(path, typ string, der []byte, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: typ, Bytes: der}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
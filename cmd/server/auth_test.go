@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenAuth(t *testing.T) {
+	h := authMiddleware(serverConfig{Token: "s3cret"}, setup(t))
+
+	if rec := do(h, "GET", "/", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("no token: got %d, want 403", rec.Code)
+	}
+	if rec := do(h, "GET", "/?token=wrong", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("wrong token: got %d, want 403", rec.Code)
+	}
+
+	rec := do(h, "GET", "/stats?deck=words&token=s3cret", nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/stats?deck=words" {
+		t.Fatalf("token login: got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected token cookie, got %v", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/stats?deck=words", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("with cookie: got %d, want 200", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("with bearer: got %d, want 200", rec.Code)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	h := authMiddleware(serverConfig{User: "kobo", Password: "pw"}, setup(t))
+
+	if rec := do(h, "GET", "/", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("no credentials: got %d, want 401", rec.Code)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("kobo", "pw")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("with credentials: got %d, want 200", rec.Code)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	h := setup(t)
+	srvCfg.ReadOnly = true
+	defer func() { srvCfg.ReadOnly = false }()
+
+	rec := do(h, "POST", "/rate", url.Values{"deck": {"words"}, "front": {"hallo"}, "q": {"3"}})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("rate in read-only: got %d, want 403", rec.Code)
+	}
+	rec = do(h, "POST", "/decks/delete", url.Values{"deck": {"words"}})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("delete in read-only: got %d, want 403", rec.Code)
+	}
+	if rec := do(h, "GET", "/study?deck=words", nil); rec.Code != http.StatusOK {
+		t.Fatalf("study in read-only: got %d, want 200", rec.Code)
+	}
+}
+
+func TestEnsureCert(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := filepath.Join(dir, "c.pem"), filepath.Join(dir, "k.pem")
+	if err := ensureCert(cert, key, "192.168.1.5"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.LoadX509KeyPair(cert, key); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverConfig holds the web-server-only settings from anki-server.conf.
+type serverConfig struct {
+	Bind        string // empty listens on all interfaces
+	Port        int
+	Token       string // shared secret; empty disables token auth
+	User        string // basic-auth user; empty disables basic auth
+	Password    string
+	TLS         bool
+	TLSCert     string
+	TLSKey      string
+	ReadOnly    bool
+	IdleTimeout time.Duration // stop after this long without requests; 0 disables
+	TemplateDir string        // optional directory of *.html overriding the embedded templates
+}
+
+func defaultServerConfig() serverConfig {
+	return serverConfig{
+		Port:    8080,
+		TLSCert: "server.crt",
+		TLSKey:  "server.key",
+	}
+}
+
+func loadServerConfig(path string) serverConfig {
+	cfg := defaultServerConfig()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return cfg
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, val := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch key {
+		case "bind":
+			cfg.Bind = val
+		case "port":
+			if v, err := strconv.Atoi(val); err == nil {
+				cfg.Port = v
+			}
+		case "token":
+			cfg.Token = val
+		case "auth_user":
+			cfg.User = val
+		case "auth_password":
+			cfg.Password = val
+		case "tls":
+			cfg.TLS = val == "true" || val == "1"
+		case "tls_cert":
+			cfg.TLSCert = val
+		case "tls_key":
+			cfg.TLSKey = val
+		case "read_only":
+			cfg.ReadOnly = val == "true" || val == "1"
+		case "template_dir":
+			cfg.TemplateDir = val
+		case "idle_timeout":
+			if v, err := strconv.Atoi(val); err == nil {
+				cfg.IdleTimeout = time.Duration(v) * time.Minute
+			}
+		}
+	}
+	return cfg
+}
+
+func (c serverConfig) Addr() string {
+	return net.JoinHostPort(c.Bind, strconv.Itoa(c.Port))
+}
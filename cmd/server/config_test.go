@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBindDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anki-server.conf")
+	if addr := loadServerConfig(path).Addr(); addr != ":8080" {
+		t.Errorf("address without config: %s, want :8080 on all interfaces", addr)
+	}
+	os.WriteFile(path, []byte("bind=127.0.0.1\n"), 0644)
+	if addr := loadServerConfig(path).Addr(); addr != "127.0.0.1:8080" {
+		t.Errorf("bind=127.0.0.1: %s", addr)
+	}
+}
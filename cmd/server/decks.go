@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"kobo-anki/core"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// maxUploadSize bounds deck uploads; real decks are a few hundred KB at most.
+const maxUploadSize = 8 << 20
+
+// requirePost rejects anything but POST for state-changing routes.
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// deckError maps core deck errors to HTTP status codes.
+func deckError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, core.ErrInvalidDeckName):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, core.ErrDeckExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, core.ErrDeckNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func manageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	cardsMu.RLock()
+	decks := core.ListDecks(dataDir)
+	invalid := core.InvalidDecks(dataDir)
+	cardsMu.RUnlock()
+	data := struct {
+		Decks    []core.DeckName
+		Invalid  []string
+		ReadOnly bool
+	}{decks, invalid, srvCfg.ReadOnly}
+	tmpl.ExecuteTemplate(w, "manage", data)
+}
+
+func downloadHandler(w http.ResponseWriter, r *http.Request) {
+	cardsMu.RLock()
+	defer cardsMu.RUnlock()
+	deck, ok := deckParam(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+strings.ReplaceAll(string(deck), `"`, "")+`.csv"`)
+	http.ServeFile(w, r, core.DeckCSVPath(dataDir, deck))
+}
+
+func uploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing or oversized file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	comma := ','
+	switch ext {
+	case ".csv":
+	case ".tsv", ".txt":
+		comma = '\t'
+	default:
+		http.Error(w, "only .csv and .tsv files are supported", http.StatusBadRequest)
+		return
+	}
+
+	raw := strings.TrimSpace(r.FormValue("name"))
+	if raw == "" {
+		raw = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+	name, err := core.ParseDeckName(raw)
+	if err != nil {
+		deckError(w, err)
+		return
+	}
+
+	uploaded, err := core.ReadCards(file, comma)
+	if err != nil {
+		http.Error(w, "could not parse deck: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cardsMu.Lock()
+	err = core.CreateDeck(dataDir, name, uploaded)
+	cardsMu.Unlock()
+	if err != nil {
+		deckError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/decks", http.StatusSeeOther)
+}
+
+func createHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	name, err := core.ParseDeckName(strings.TrimSpace(r.FormValue("name")))
+	if err != nil {
+		deckError(w, err)
+		return
+	}
+	cardsMu.Lock()
+	err = core.CreateDeck(dataDir, name, nil)
+	cardsMu.Unlock()
+	if err != nil {
+		deckError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/decks", http.StatusSeeOther)
+}
+
+func renameHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	name, err := core.ParseDeckName(strings.TrimSpace(r.FormValue("name")))
+	if err != nil {
+		deckError(w, err)
+		return
+	}
+	cardsMu.Lock()
+	defer cardsMu.Unlock()
+	deck, ok := deckParam(w, r)
+	if !ok {
+		return
+	}
+	if err := core.RenameDeck(dataDir, deck, name); err != nil {
+		deckError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/decks", http.StatusSeeOther)
+}
+
+func deleteHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	cardsMu.Lock()
+	defer cardsMu.Unlock()
+	deck, ok := deckParam(w, r)
+	if !ok {
+		return
+	}
+	if err := core.TrashDeck(dataDir, deck); err != nil {
+		deckError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/decks", http.StatusSeeOther)
+}
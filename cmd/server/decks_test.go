@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"kobo-anki/core"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// upload posts data as a multipart file named filename to /decks/upload.
+func upload(h http.Handler, filename, data string, form url.Values) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, vs := range form {
+		for _, v := range vs {
+			mw.WriteField(k, v)
+		}
+	}
+	fw, _ := mw.CreateFormFile("file", filename)
+	fw.Write([]byte(data))
+	mw.Close()
+	req := httptest.NewRequest("POST", "/decks/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func deckFronts(t *testing.T, deck core.DeckName) []string {
+	t.Helper()
+	cards, err := core.LoadCards(core.DeckCSVPath(dataDir, deck))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fronts []string
+	for _, c := range cards {
+		fronts = append(fronts, c.Front)
+	}
+	return fronts
+}
+
+func TestUpload(t *testing.T) {
+	h := setup(t)
+	for _, tc := range []struct {
+		filename, data string
+		form           url.Values
+		deck           core.DeckName
+		fronts         string
+	}{
+		{"dutch.csv", "front,back\nhallo,hello\nfiets,bicycle\n", nil, "dutch", "hallo|fiets"},
+		{"Anki export.txt", "#separator:tab\n#html:true\nhond\tdog\nkat\tcat\n", nil, "Anki export", "hond|kat"},
+		{"x.tsv", "boek\tbook\n", url.Values{"name": {"books"}}, "books", "boek"},
+	} {
+		if rec := upload(h, tc.filename, tc.data, tc.form); rec.Code != http.StatusSeeOther {
+			t.Errorf("upload %s: got %d %s", tc.filename, rec.Code, rec.Body.String())
+			continue
+		}
+		if got := strings.Join(deckFronts(t, tc.deck), "|"); got != tc.fronts {
+			t.Errorf("upload %s: deck %q has %q, want %q", tc.filename, tc.deck, got, tc.fronts)
+		}
+	}
+
+	for _, tc := range []struct {
+		filename string
+		form     url.Values
+		want     int
+	}{
+		{"words.csv", nil, http.StatusConflict},
+		{"deck.json", nil, http.StatusBadRequest},
+		{"deck.csv", url.Values{"name": {"../evil"}}, http.StatusBadRequest},
+	} {
+		if rec := upload(h, tc.filename, "front,back\na,b\n", tc.form); rec.Code != tc.want {
+			t.Errorf("upload %s %v: got %d, want %d", tc.filename, tc.form, rec.Code, tc.want)
+		}
+	}
+	if got := deckFronts(t, "words"); len(got) != 1 || got[0] != "hallo" {
+		t.Errorf("existing deck overwritten: %q", got)
+	}
+}
+
+func TestCreateRenameDelete(t *testing.T) {
+	h := setup(t)
+	if rec := do(h, "POST", "/decks/create", url.Values{"name": {"new"}}); rec.Code != http.StatusSeeOther {
+		t.Fatalf("create: got %d", rec.Code)
+	}
+	if !core.DeckExists(dataDir, "new") {
+		t.Fatal("created deck missing")
+	}
+	if rec := do(h, "POST", "/decks/create", url.Values{"name": {"new"}}); rec.Code != http.StatusConflict {
+		t.Errorf("create existing: got %d, want 409", rec.Code)
+	}
+
+	if rec := do(h, "POST", "/decks/rename", url.Values{"deck": {"new"}, "name": {"renamed"}}); rec.Code != http.StatusSeeOther {
+		t.Fatalf("rename: got %d", rec.Code)
+	}
+	if core.DeckExists(dataDir, "new") || !core.DeckExists(dataDir, "renamed") {
+		t.Fatal("deck not renamed")
+	}
+	if rec := do(h, "POST", "/decks/rename", url.Values{"deck": {"renamed"}, "name": {"words"}}); rec.Code != http.StatusConflict {
+		t.Errorf("rename onto existing: got %d, want 409", rec.Code)
+	}
+	if rec := do(h, "POST", "/decks/rename", url.Values{"deck": {"missing"}, "name": {"x"}}); rec.Code != http.StatusNotFound {
+		t.Errorf("rename missing: got %d, want 404", rec.Code)
+	}
+
+	if rec := do(h, "POST", "/decks/delete", url.Values{"deck": {"renamed"}}); rec.Code != http.StatusSeeOther {
+		t.Fatalf("delete: got %d", rec.Code)
+	}
+	if core.DeckExists(dataDir, "renamed") {
+		t.Fatal("deleted deck still listed")
+	}
+	if trashed, _ := filepath.Glob(filepath.Join(dataDir, core.TrashDir, "renamed*")); len(trashed) != 1 {
+		t.Errorf("deleted deck not in trash: %v", trashed)
+	}
+	if rec := do(h, "POST", "/decks/delete", url.Values{"deck": {"renamed"}}); rec.Code != http.StatusNotFound {
+		t.Errorf("delete twice: got %d, want 404", rec.Code)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	h := setup(t)
+	rec := do(h, "GET", "/decks/download?deck=words", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("download: got %d", rec.Code)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename="words.csv"` {
+		t.Errorf("Content-Disposition %q", cd)
+	}
+	want, _ := os.ReadFile(core.DeckCSVPath(dataDir, "words"))
+	if rec.Body.String() != string(want) {
+		t.Errorf("downloaded %q, want %q", rec.Body.String(), want)
+	}
+	if rec := do(h, "GET", "/decks/download?deck=missing", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("download missing: got %d, want 404", rec.Code)
+	}
+}
+
+func TestManageInvalidDecks(t *testing.T) {
+	h := setup(t)
+	if err := os.WriteFile(filepath.Join(dataDir, "a:b.csv"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	body := do(h, "GET", "/decks", nil).Body.String()
+	if !strings.Contains(body, "a:b.csv") {
+		t.Error("manage page does not mention the skipped a:b.csv")
+	}
+	if strings.Contains(body, `value="a:b"`) {
+		t.Error("manage page offers to rename a:b, which it can't open")
+	}
+}
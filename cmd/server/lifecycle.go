@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout bounds how long in-flight requests get to finish.
+const shutdownTimeout = 10 * time.Second
+
+// lifecycle is the shutdown state of one serve call. Handlers reach it
+// through the request context.
+type lifecycle struct {
+	lastActivity atomic.Int64 // unix nanos of the last non-health request
+	once         sync.Once
+	done         chan struct{}
+}
+
+type lifecycleKey struct{}
+
+func newLifecycle() *lifecycle {
+	lc := &lifecycle{done: make(chan struct{})}
+	lc.touch()
+	return lc
+}
+
+// lifecycleOf returns the lifecycle serving r, or nil outside serve.
+func lifecycleOf(r *http.Request) *lifecycle {
+	lc, _ := r.Context().Value(lifecycleKey{}).(*lifecycle)
+	return lc
+}
+
+// shutdown asks serve to stop the server. Safe to call repeatedly, and a
+// no-op on a nil lifecycle.
+func (lc *lifecycle) shutdown(reason string) {
+	if lc == nil {
+		return
+	}
+	lc.once.Do(func() {
+		log.Printf("Shutting down: %s", reason)
+		close(lc.done)
+	})
+}
+
+func (lc *lifecycle) touch() { lc.lastActivity.Store(time.Now().UnixNano()) }
+
+// trackActivity records request times for the idle timeout. Health checks
+// don't count, so a launcher polling /healthz can't keep the server alive.
+func trackActivity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lc := lifecycleOf(r); lc != nil && r.URL.Path != "/healthz" {
+			lc.touch()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// watchIdle shuts the server down once no request has arrived for timeout.
+func (lc *lifecycle) watchIdle(timeout time.Duration) {
+	tick := timeout / 10
+	if tick > time.Minute {
+		tick = time.Minute
+	}
+	for {
+		select {
+		case <-lc.done:
+			return
+		case <-time.After(tick):
+		}
+		idle := time.Since(time.Unix(0, lc.lastActivity.Load()))
+		if idle >= timeout {
+			lc.shutdown("idle for " + idle.Round(time.Second).String())
+			return
+		}
+	}
+}
+
+// serve runs srv until it fails, a SIGINT/SIGTERM arrives, /quit is
+// requested, or, with idleTimeout > 0, no request has come for that long.
+// It then lets in-flight requests finish and waits for any deck write
+// holding cardsMu.
+func serve(srv *http.Server, listen func() error, idleTimeout time.Duration) error {
+	lc := newLifecycle()
+	srv.BaseContext = func(net.Listener) context.Context {
+		return context.WithValue(context.Background(), lifecycleKey{}, lc)
+	}
+	defer lc.once.Do(func() { close(lc.done) }) // stop the idle watcher
+	if idleTimeout > 0 {
+		go lc.watchIdle(idleTimeout)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- listen() }()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case sig := <-sigCh:
+		lc.shutdown(sig.String())
+	case <-lc.done:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+
+	cardsMu.Lock()
+	cardsMu.Unlock()
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHealthzBypassesAuth(t *testing.T) {
+	h := authMiddleware(serverConfig{Token: "s3cret", User: "kobo"}, setup(t))
+	rec := do(h, "GET", "/healthz", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok\n" {
+		t.Fatalf("healthz: got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestIdleShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: trackActivity(setup(t))}
+	done := make(chan error, 1)
+	go func() { done <- serve(srv, func() error { return srv.Serve(ln) }, 50*time.Millisecond) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down after idle timeout")
+	}
+}
+
+// TestQuitPerServe stops two servers in turn with /quit: the first
+// shutdown must not stop, or fail to stop, the next one.
+func TestQuitPerServe(t *testing.T) {
+	h := trackActivity(setup(t))
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := &http.Server{Handler: h}
+		done := make(chan error, 1)
+		go func() { done <- serve(srv, func() error { return srv.Serve(ln) }, 0) }()
+
+		select {
+		case <-done:
+			t.Fatalf("server %d stopped before /quit", i)
+		case <-time.After(50 * time.Millisecond):
+		}
+		resp, err := http.Post("http://"+ln.Addr().String()+"/quit", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("serve %d: %v", i, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("server %d did not stop on /quit", i)
+		}
+	}
+}
+
+func TestIdleTimeoutOptIn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anki-server.conf")
+	if cfg := loadServerConfig(path); cfg.IdleTimeout != 0 {
+		t.Errorf("idle timeout without config: %s, want off", cfg.IdleTimeout)
+	}
+	os.WriteFile(path, []byte("idle_timeout=30\n"), 0644)
+	if cfg := loadServerConfig(path); cfg.IdleTimeout != 30*time.Minute {
+		t.Errorf("idle_timeout=30: %s", cfg.IdleTimeout)
+	}
+}
@@ -5,9 +5,10 @@ import (
 	"kobo-anki/core"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,20 +21,68 @@ var (
 	tmpl    *template.Template
 	csvFile string
 	dataDir = "."
+	srvCfg  = defaultServerConfig()
+	session core.Session // guarded by cardsMu
 )
 
+// sessionIdle is how long a deck can go without reviews before studying it
+// again counts as a new session.
+const sessionIdle = time.Hour
+
 type studyData struct {
-	Card    *core.Card
-	Deck    string
-	Key     string // original card.Front for URL lookups
-	Reverse bool
+	Card     *core.Card
+	Deck     core.DeckName
+	Key      string // original card.Front for URL lookups
+	Reverse  bool
+	ReadOnly bool
+}
+
+// doneData summarizes the session for the done page.
+type doneData struct {
+	Deck                    core.DeckName
+	Reviews                 int
+	Minutes                 int
+	Again, Hard, Good, Easy int
+	New, Lapses             int
+	NextDue                 string // e.g. "in 5h"; empty if the deck has no cards
+}
+
+// deckSession returns the session for deck, starting a new one if another
+// deck was studied last or the session has been idle. Callers hold cardsMu.
+func deckSession(deck core.DeckName) *core.Session {
+	now := time.Now()
+	if session.Deck != deck || now.Sub(session.Last) > sessionIdle {
+		session = core.NewSession(deck, now)
+	}
+	return &session
+}
+
+// newDoneData builds the done page for deck from the current session and
+// cards. Callers hold cardsMu.
+func newDoneData(deck core.DeckName) doneData {
+	s := deckSession(deck)
+	d := doneData{
+		Deck:    deck,
+		Reviews: s.Reviews(),
+		Minutes: max(int(s.Duration().Round(time.Minute).Minutes()), 1),
+		Again:   s.Ratings[fsrs.Again],
+		Hard:    s.Ratings[fsrs.Hard],
+		Good:    s.Ratings[fsrs.Good],
+		Easy:    s.Ratings[fsrs.Easy],
+		New:     s.New,
+		Lapses:  s.Lapses,
+	}
+	if due := core.NextDue(cards); !due.IsZero() {
+		d.NextDue = core.FormatDue(due, time.Now())
+	}
+	return d
 }
 
 func indexHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	type DeckInfo struct {
-		Name string
+		Name core.DeckName
 		Due  int
 	}
 
@@ -52,30 +101,61 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 	tmpl.ExecuteTemplate(w, "index", deckInfos)
 }
 
+// deckParam validates the "deck" form/query value and checks that the deck
+// exists, replying 400 or 404 otherwise.
+func deckParam(w http.ResponseWriter, r *http.Request) (core.DeckName, bool) {
+	deck, err := core.ParseDeckName(r.FormValue("deck"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	if !core.DeckExists(dataDir, deck) {
+		http.Error(w, core.ErrDeckNotFound.Error(), http.StatusNotFound)
+		return "", false
+	}
+	return deck, true
+}
+
+// studyURL builds the /study link for a deck, escaping the name.
+func studyURL(deck core.DeckName, reverse bool) string {
+	v := url.Values{"deck": {string(deck)}}
+	if reverse {
+		v.Set("reverse", "1")
+	}
+	return "/study?" + v.Encode()
+}
+
 func studyHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	deck := r.URL.Query().Get("deck")
-	if deck == "" {
+	if r.URL.Query().Get("deck") == "" {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
+	deck, ok := deckParam(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	reverse := r.URL.Query().Get("reverse") == "1"
 
 	cardsMu.Lock()
 	csvFile = core.DeckCSVPath(dataDir, deck)
 	var err error
 	cards, err = core.LoadCards(csvFile)
-	cardsMu.Unlock()
 	if err != nil {
+		cardsMu.Unlock()
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-
-	cardsMu.RLock()
 	card := core.RandomDueCard(cards)
-	cardsMu.RUnlock()
+	var done doneData
 	if card == nil {
-		tmpl.ExecuteTemplate(w, "done", deck)
+		done = newDoneData(deck)
+	} else {
+		deckSession(deck)
+	}
+	cardsMu.Unlock()
+	if card == nil {
+		tmpl.ExecuteTemplate(w, "done", done)
 		return
 	}
 
@@ -83,13 +163,16 @@ func studyHandler(w http.ResponseWriter, r *http.Request) {
 	if reverse {
 		display.Front, display.Back = display.Back, display.Front
 	}
-	tmpl.ExecuteTemplate(w, "front", studyData{&display, deck, card.Front, reverse})
+	tmpl.ExecuteTemplate(w, "front", studyData{&display, deck, card.Front, reverse, srvCfg.ReadOnly})
 }
 
 func backHandler(w http.ResponseWriter, r *http.Request) {
+	deck, ok := deckParam(w, r)
+	if !ok {
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	front := r.URL.Query().Get("front") // always the original card.Front
-	deck := r.URL.Query().Get("deck")
 	reverse := r.URL.Query().Get("reverse") == "1"
 
 	cardsMu.Lock()
@@ -101,7 +184,7 @@ func backHandler(w http.ResponseWriter, r *http.Request) {
 	card := core.FindCard(cards, front)
 	cardsMu.RUnlock()
 	if card == nil {
-		http.Redirect(w, r, "/study?deck="+deck, http.StatusSeeOther)
+		http.Redirect(w, r, studyURL(deck, reverse), http.StatusSeeOther)
 		return
 	}
 
@@ -109,14 +192,20 @@ func backHandler(w http.ResponseWriter, r *http.Request) {
 	if reverse {
 		display.Front, display.Back = display.Back, display.Front
 	}
-	tmpl.ExecuteTemplate(w, "back", studyData{&display, deck, card.Front, reverse})
+	tmpl.ExecuteTemplate(w, "back", studyData{&display, deck, card.Front, reverse, srvCfg.ReadOnly})
 }
 
 func rateHandler(w http.ResponseWriter, r *http.Request) {
-	front := r.URL.Query().Get("front")
-	deck := r.URL.Query().Get("deck")
-	q, _ := strconv.Atoi(r.URL.Query().Get("q"))
-	reverse := r.URL.Query().Get("reverse")
+	if !requirePost(w, r) {
+		return
+	}
+	deck, ok := deckParam(w, r)
+	if !ok {
+		return
+	}
+	front := r.FormValue("front")
+	q, _ := strconv.Atoi(r.FormValue("q"))
+	reverse := r.FormValue("reverse") == "1"
 
 	cardsMu.Lock()
 	csvFile = core.DeckCSVPath(dataDir, deck)
@@ -127,21 +216,30 @@ func rateHandler(w http.ResponseWriter, r *http.Request) {
 		if rating < fsrs.Again || rating > fsrs.Easy {
 			rating = fsrs.Good
 		}
-		core.Review(card, rating)
-		core.SaveCards(csvFile, cards)
+		s := deckSession(deck)
+		savedSession, savedCard := *s, *card
+		s.Review(card, rating)
+		if err := core.SaveCards(csvFile, cards); err != nil {
+			// Undo the review, so it is neither counted nor kept in
+			// memory when the deck on disk doesn't have it.
+			*s, *card = savedSession, savedCard
+			cardsMu.Unlock()
+			log.Printf("Saving %s: %v", csvFile, err)
+			http.Error(w, "could not save the deck", http.StatusInternalServerError)
+			return
+		}
 	}
 	cardsMu.Unlock()
 
-	redirect := "/study?deck=" + deck
-	if reverse == "1" {
-		redirect += "&reverse=1"
-	}
-	http.Redirect(w, r, redirect, http.StatusSeeOther)
+	http.Redirect(w, r, studyURL(deck, reverse), http.StatusSeeOther)
 }
 
 func statsHandler(w http.ResponseWriter, r *http.Request) {
+	deck, ok := deckParam(w, r)
+	if !ok {
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	deck := r.URL.Query().Get("deck")
 
 	cardsMu.Lock()
 	csvFile = core.DeckCSVPath(dataDir, deck)
@@ -154,13 +252,63 @@ func statsHandler(w http.ResponseWriter, r *http.Request) {
 	cardsMu.RUnlock()
 
 	data := struct {
-		Deck  string
+		Deck  core.DeckName
 		Total int
 		Due   int
 	}{deck, total, due}
 	tmpl.ExecuteTemplate(w, "stats", data)
 }
 
+// mediaHandler serves the images cards reference from the media folder.
+func mediaHandler(w http.ResponseWriter, r *http.Request) {
+	path, err := core.MediaPath(dataDir, strings.TrimPrefix(r.URL.Path, "/media/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
+
+func quitHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte("<html><body bgcolor='#FFFFFF'><center><br><br><br><font size='6'><b>Server stopped.</b></font></center></body></html>"))
+	// Shutdown waits for this handler to return, so the page is delivered.
+	lifecycleOf(r).shutdown("quit requested")
+}
+
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", indexHandler)
+	mux.HandleFunc("/study", studyHandler)
+	mux.HandleFunc("/back", backHandler)
+	mux.HandleFunc("/rate", writable(rateHandler))
+	mux.HandleFunc("/stats", statsHandler)
+	mux.HandleFunc("/media/", mediaHandler)
+	mux.HandleFunc("/decks", manageHandler)
+	mux.HandleFunc("/decks/download", downloadHandler)
+	mux.HandleFunc("/decks/upload", writable(uploadHandler))
+	mux.HandleFunc("/decks/create", writable(createHandler))
+	mux.HandleFunc("/decks/rename", writable(renameHandler))
+	mux.HandleFunc("/decks/delete", writable(deleteHandler))
+	mux.HandleFunc("/quit", quitHandler)
+	mux.HandleFunc("/healthz", healthzHandler)
+	return mux
+}
+
 func main() {
 	coreCfg := core.LoadCoreConfig("anki-core.conf")
 	dataDir = coreCfg.DataDir
@@ -171,30 +319,50 @@ func main() {
 	}
 
 	log.Printf("Data dir: %s", dataDir)
+	for _, name := range core.InvalidDecks(dataDir) {
+		log.Printf("Skipping %s.csv: not a valid deck name", name)
+	}
+
+	srvCfg = loadServerConfig("anki-server.conf")
 
 	var err error
-	tmpl, err = template.ParseGlob(filepath.Join(filepath.Dir(os.Args[0]), "templates", "*.html"))
+	tmpl, err = loadTemplates(srvCfg.TemplateDir)
 	if err != nil {
-		tmpl, err = template.ParseGlob("templates/*.html")
-		if err != nil {
-			log.Fatalf("Failed to parse templates: %v", err)
+		log.Fatalf("Failed to parse templates: %v", err)
+	}
+	if srvCfg.TemplateDir != "" {
+		log.Printf("Template overrides: %s", srvCfg.TemplateDir)
+	}
+	if srvCfg.ReadOnly {
+		log.Println("Read-only mode: ratings and deck changes are disabled")
+	}
+
+	srv := &http.Server{
+		Addr:              srvCfg.Addr(),
+		Handler:           trackActivity(authMiddleware(srvCfg, newMux())),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	listen := srv.ListenAndServe
+	scheme := "http"
+	if srvCfg.TLS {
+		if err := ensureCert(srvCfg.TLSCert, srvCfg.TLSKey, srvCfg.Bind); err != nil {
+			log.Fatalf("TLS certificate: %v", err)
 		}
+		listen = func() error { return srv.ListenAndServeTLS(srvCfg.TLSCert, srvCfg.TLSKey) }
+		scheme = "https"
 	}
 
-	http.HandleFunc("/", indexHandler)
-	http.HandleFunc("/study", studyHandler)
-	http.HandleFunc("/back", backHandler)
-	http.HandleFunc("/rate", rateHandler)
-	http.HandleFunc("/stats", statsHandler)
-	http.HandleFunc("/quit", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Write([]byte("<html><body bgcolor='#FFFFFF'><center><br><br><br><font size='6'><b>Server stopped.</b></font></center></body></html>"))
-		go func() {
-			time.Sleep(500 * time.Millisecond)
-			os.Exit(0)
-		}()
-	})
-
-	log.Println("Listening on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	if srvCfg.IdleTimeout > 0 {
+		log.Printf("Idle timeout: %s", srvCfg.IdleTimeout)
+	}
+
+	if srvCfg.Bind == "" {
+		log.Printf("Listening on %s://%s (all interfaces)", scheme, srvCfg.Addr())
+	} else {
+		log.Printf("Listening on %s://%s", scheme, srvCfg.Addr())
+	}
+	if err := serve(srv, listen, srvCfg.IdleTimeout); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Server stopped")
 }
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"kobo-anki/core"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setup points the server at a temp data dir holding one deck, "words",
+// plus a secret file one level up that traversal attempts aim for.
+func setup(t *testing.T) http.Handler {
+	t.Helper()
+	root := t.TempDir()
+	dataDir = filepath.Join(root, "data")
+	if err := os.Mkdir(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret.csv"), []byte("front,back\nkey,hunter2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.CreateDeck(dataDir, "words", []core.Card{{Front: "hallo", Back: "hello"}}); err != nil {
+		t.Fatal(err)
+	}
+	session = core.Session{}
+	var err error
+	if tmpl, err = loadTemplates(""); err != nil {
+		t.Fatal(err)
+	}
+	return newMux()
+}
+
+func do(h http.Handler, method, target string, form url.Values) *httptest.ResponseRecorder {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMediaRoute(t *testing.T) {
+	h := setup(t)
+	dir := filepath.Join(dataDir, core.MediaDir)
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a cat.png"), []byte("png data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(h, "GET", "/media/a%20cat.png", nil); rec.Code != http.StatusOK || rec.Body.String() != "png data" {
+		t.Errorf("GET media file: %d %q", rec.Code, rec.Body.String())
+	}
+	for path, want := range map[string]int{
+		"/media/missing.png":          http.StatusNotFound,
+		"/media/sub":                  http.StatusNotFound,
+		"/media/..%2Fwords.csv":       http.StatusBadRequest,
+		"/media/..%2F..%2Fsecret.csv": http.StatusBadRequest,
+	} {
+		rec := do(h, "GET", path, nil)
+		if rec.Code != want {
+			t.Errorf("GET %s: got %d, want %d", path, rec.Code, want)
+		}
+		if strings.Contains(rec.Body.String(), "hunter2") {
+			t.Errorf("GET %s leaked file outside media dir", path)
+		}
+	}
+}
+
+func TestTraversalRejected(t *testing.T) {
+	h := setup(t)
+	for _, deck := range []string{"../secret", "..%2Fsecret", "/etc/passwd", "a/../../secret", ".hidden", "..", ""} {
+		for _, path := range []string{"/back", "/stats", "/decks/download"} {
+			rec := do(h, "GET", path+"?front=key&deck="+url.QueryEscape(deck), nil)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("GET %s deck=%q: got %d, want 400", path, deck, rec.Code)
+			}
+			if strings.Contains(rec.Body.String(), "hunter2") {
+				t.Errorf("GET %s deck=%q leaked file outside data dir", path, deck)
+			}
+		}
+	}
+}
+
+func TestRateDoesNotCreateFiles(t *testing.T) {
+	h := setup(t)
+	for _, deck := range []string{"../evil", "nope"} {
+		rec := do(h, "POST", "/rate", url.Values{"deck": {deck}, "front": {"x"}, "q": {"3"}})
+		if rec.Code != http.StatusBadRequest && rec.Code != http.StatusNotFound {
+			t.Errorf("POST /rate deck=%q: got %d", deck, rec.Code)
+		}
+	}
+	for _, p := range []string{filepath.Join(dataDir, "..", "evil.csv"), filepath.Join(dataDir, "nope.csv")} {
+		if _, err := os.Stat(p); err == nil {
+			t.Errorf("rate created %s", p)
+		}
+	}
+}
+
+func TestUnknownDeck404(t *testing.T) {
+	h := setup(t)
+	for _, path := range []string{"/study?deck=missing", "/back?deck=missing&front=x", "/stats?deck=missing"} {
+		if rec := do(h, "GET", path, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s: got %d, want 404", path, rec.Code)
+		}
+	}
+}
+
+func TestStateChangingRoutesRequirePost(t *testing.T) {
+	h := setup(t)
+	for _, path := range []string{"/rate?deck=words&front=hallo&q=3", "/quit", "/decks/create?name=x", "/decks/delete?deck=words", "/decks/rename?deck=words&name=x"} {
+		if rec := do(h, "GET", path, nil); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: got %d, want 405", path, rec.Code)
+		}
+	}
+	if !core.DeckExists(dataDir, "words") {
+		t.Fatal("deck was modified by a GET request")
+	}
+}
+
+func TestRateUpdatesDeck(t *testing.T) {
+	h := setup(t)
+	rec := do(h, "POST", "/rate", url.Values{"deck": {"words"}, "front": {"hallo"}, "q": {"3"}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("POST /rate: got %d", rec.Code)
+	}
+	got, err := core.LoadCards(core.DeckCSVPath(dataDir, "words"))
+	if err != nil || len(got) != 1 || got[0].Reps != 1 {
+		t.Fatalf("card not reviewed: %+v, %v", got, err)
+	}
+}
+
+func TestRateSaveFailure(t *testing.T) {
+	h := setup(t)
+	// SaveCards writes a temp file next to the deck; a directory in its
+	// place makes the save fail.
+	if err := os.Mkdir(core.DeckCSVPath(dataDir, "words")+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	rec := do(h, "POST", "/rate", url.Values{"deck": {"words"}, "front": {"hallo"}, "q": {"3"}})
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("POST /rate with a failing save: got %d, want 500", rec.Code)
+	}
+	if n := session.Reviews(); n != 0 {
+		t.Errorf("session counts %d reviews after the failed save, want 0", n)
+	}
+	if c := core.FindCard(cards, "hallo"); c == nil || c.Reps != 0 {
+		t.Errorf("card in memory after the failed save: %+v, want unreviewed", c)
+	}
+}
+
+func TestDoneSummary(t *testing.T) {
+	h := setup(t)
+	do(h, "GET", "/study?deck=words", nil)
+	do(h, "POST", "/rate", url.Values{"deck": {"words"}, "front": {"hallo"}, "q": {"3"}})
+	rec := do(h, "GET", "/study?deck=words", nil)
+	body := rec.Body.String()
+	for _, want := range []string{"All done!", "1 in 1 min", "0 / 0 / 1 / 0", "Next card due in "} {
+		if !strings.Contains(body, want) {
+			t.Errorf("done page missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestRenameRejectsTraversal(t *testing.T) {
+	h := setup(t)
+	rec := do(h, "POST", "/decks/rename", url.Values{"deck": {"words"}, "name": {"../moved"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("rename to ../moved: got %d, want 400", rec.Code)
+	}
+	if !core.DeckExists(dataDir, "words") {
+		t.Fatal("deck moved despite invalid name")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"html/template"
+	"kobo-anki/core"
+	"kobo-anki/templates"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/open-spaced-repetition/go-fsrs/v3"
+)
+
+// templateFuncs are available to all templates, overrides included.
+// {{rich .Card.Front}} renders a card field's markup as sanitized HTML, and
+// {{range images .Card.Front}} and {{range sounds .Card.Back}} list the
+// /media/ URLs of its images and sounds. {{interval .Card 3}} is how long
+// until the card is due again if rated 3 (Good) now, e.g. "4d".
+var templateFuncs = template.FuncMap{
+	"rich":     func(s string) template.HTML { return template.HTML(core.RichHTML(s)) },
+	"images":   func(s string) []string { return mediaURLs(core.Images(s)) },
+	"sounds":   func(s string) []string { return mediaURLs(core.Sounds(s)) },
+	"interval": interval,
+}
+
+// interval formats the interval card would get for rating q.
+func interval(card *core.Card, q int) string {
+	if card == nil || q < int(fsrs.Again) || q > int(fsrs.Easy) {
+		return ""
+	}
+	return core.FormatInterval(core.Intervals(*card, time.Now())[q])
+}
+
+// mediaURLs links media file names to the /media/ route, skipping names
+// the route would reject.
+func mediaURLs(names []string) []string {
+	var urls []string
+	for _, name := range names {
+		if _, err := core.MediaPath(dataDir, name); err == nil {
+			urls = append(urls, "/media/"+url.PathEscape(name))
+		}
+	}
+	return urls
+}
+
+// loadTemplates parses the embedded default templates, then any *.html in
+// overrideDir on top. An override file only needs to {{define}} the
+// templates it changes; the rest keep their embedded version.
+func loadTemplates(overrideDir string) (*template.Template, error) {
+	t, err := template.New("").Funcs(templateFuncs).ParseFS(templates.FS, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	if overrideDir == "" {
+		return t, nil
+	}
+	files, err := filepath.Glob(filepath.Join(overrideDir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		if _, err := os.Stat(overrideDir); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	return t.ParseFiles(files...)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"io"
+	"kobo-anki/core"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleData returns representative data for each template, shaped like
+// what the handlers pass. Every embedded template must have an entry.
+func sampleData() map[string]any {
+	card := &core.Card{Front: "<script>alert(1)</script>hallo", Back: "hello & <i>bye</i>", Due: time.Now()}
+	type deckInfo struct {
+		Name core.DeckName
+		Due  int
+	}
+	return map[string]any{
+		"index": []deckInfo{{"dutch", 3}, {"with space", 0}},
+		"front": studyData{Card: card, Deck: "dutch", Key: "hallo"},
+		"back":  studyData{Card: card, Deck: "dutch", Key: "hallo", Reverse: true},
+		"done":  doneData{Deck: "dutch", Reviews: 12, Minutes: 8, Again: 2, Hard: 1, Good: 6, Easy: 3, New: 4, Lapses: 1, NextDue: "in 5h"},
+		"stats": struct {
+			Deck  core.DeckName
+			Total int
+			Due   int
+		}{"dutch", 10, 3},
+		"manage": struct {
+			Decks    []core.DeckName
+			Invalid  []string
+			ReadOnly bool
+		}{[]core.DeckName{"dutch"}, []string{"a:b"}, false},
+	}
+}
+
+func TestTemplatesRender(t *testing.T) {
+	tm, err := loadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := sampleData()
+	for _, def := range tm.Templates() {
+		name := def.Name()
+		if name == "" || strings.HasSuffix(name, ".html") {
+			continue // root or file-level template, only holds {{define}}s
+		}
+		data, ok := samples[name]
+		if !ok {
+			t.Errorf("template %q has no sample data", name)
+			continue
+		}
+		var sb strings.Builder
+		if err := tm.ExecuteTemplate(&sb, name, data); err != nil {
+			t.Errorf("template %q: %v", name, err)
+			continue
+		}
+		if strings.Contains(sb.String(), "<script>") {
+			t.Errorf("template %q: card text not sanitized", name)
+		}
+	}
+	for name := range samples {
+		if tm.Lookup(name) == nil {
+			t.Errorf("sample for missing template %q", name)
+		}
+	}
+}
+
+func TestTemplatesRichText(t *testing.T) {
+	tm, err := loadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	data := studyData{Card: &core.Card{Front: "**de** fiets", Back: `a <i>bicycle</i><br>x &lt; y<img src="a b.png"><img src="../x.png">[sound:fiets.mp3]`}, Deck: "d", Key: "**de** fiets"}
+	if err := tm.ExecuteTemplate(&sb, "back", data); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<b>de</b> fiets", "a <i>bicycle</i><br>x &lt; y", `value="**de** fiets"`, `<img src="/media/a%20b.png"`, `<audio controls src="/media/fiets.mp3">`} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("back page lacks %q", want)
+		}
+	}
+	if strings.Contains(sb.String(), "x.png") {
+		t.Error("back page links an image outside the media folder")
+	}
+}
+
+func TestTemplatesIntervals(t *testing.T) {
+	tm, err := loadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	card := &core.Card{Front: "a", Back: "b"}
+	var sb strings.Builder
+	if err := tm.ExecuteTemplate(&sb, "back", studyData{Card: card, Deck: "d", Key: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	iv := core.Intervals(*card, time.Now())
+	for i, name := range []string{"Again", "Hard", "Good", "Easy"} {
+		want := name + " &middot; " + core.FormatInterval(iv[i+1])
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("back page lacks %q", want)
+		}
+	}
+}
+
+func TestTemplatesReadOnly(t *testing.T) {
+	tm, err := loadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	data := studyData{Card: &core.Card{Front: "a", Back: "b"}, Deck: "d", Key: "a", ReadOnly: true}
+	if err := tm.ExecuteTemplate(&sb, "back", data); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sb.String(), `action="/rate"`) {
+		t.Error("read-only back page still offers rating forms")
+	}
+}
+
+func TestTemplateOverride(t *testing.T) {
+	dir := t.TempDir()
+	override := `{{define "done"}}custom done for {{.}}{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "done.html"), []byte(override), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tm, err := loadTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := tm.ExecuteTemplate(&sb, "done", "dutch"); err != nil {
+		t.Fatal(err)
+	}
+	if sb.String() != "custom done for dutch" {
+		t.Fatalf("override not applied: %q", sb.String())
+	}
+	if err := tm.ExecuteTemplate(io.Discard, "front", sampleData()["front"]); err != nil {
+		t.Fatalf("non-overridden template broken: %v", err)
+	}
+
+	if _, err := loadTemplates(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected error for missing override dir")
+	}
+}
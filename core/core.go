@@ -3,6 +3,7 @@ package core
 import (
 	"bufio"
 	"encoding/csv"
+	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -124,25 +125,81 @@ func Review(card *Card, rating fsrs.Rating) {
 	card.applyFSRS(result.Card)
 }
 
+// Intervals returns how long until card would be due again for each rating,
+// indexed by fsrs.Rating (index 0 unused), without changing the card.
+func Intervals(card Card, now time.Time) [5]time.Duration {
+	var d [5]time.Duration
+	for rating, info := range scheduler.Repeat(card.fsrsCard(), now) {
+		if rating >= fsrs.Again && rating <= fsrs.Easy {
+			d[rating] = info.Card.Due.Sub(now)
+		}
+	}
+	return d
+}
+
 func IsDue(c Card) bool {
 	return !c.Due.After(time.Now())
 }
 
-func ListDecks(dataDir string) []string {
-	files, _ := filepath.Glob(filepath.Join(dataDir, "*.csv"))
+// Bury hides a card until the start of tomorrow without counting a review.
+func Bury(card *Card) {
+	y, m, d := time.Now().AddDate(0, 0, 1).Date()
+	card.Due = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// Forget clears a card's review history so it is studied as new again.
+func Forget(card *Card) {
+	*card = Card{Front: card.Front, Back: card.Back, State: fsrs.New}
+}
+
+// RemoveCard returns cards without the card whose front matches. The slice
+// is modified in place.
+func RemoveCard(cards []Card, front string) []Card {
+	for i := range cards {
+		if cards[i].Front == front {
+			return append(cards[:i], cards[i+1:]...)
+		}
+	}
+	return cards
+}
+
+// ListDecks returns the decks in dataDir. CSV files whose names aren't
+// valid deck names, e.g. copied in by hand, are left out, as nothing could
+// open them by name; InvalidDecks lists them.
+func ListDecks(dataDir string) []DeckName {
+	var result []DeckName
+	for _, name := range deckFiles(dataDir) {
+		if ValidDeckName(name) {
+			result = append(result, DeckName(name))
+		}
+	}
+	return result
+}
+
+// InvalidDecks returns the names of the CSV files in dataDir that
+// ListDecks leaves out, so the apps can tell the user to rename them.
+// Hidden files are not decks and not listed.
+func InvalidDecks(dataDir string) []string {
 	var result []string
-	for _, f := range files {
-		base := filepath.Base(f)
-		if strings.HasPrefix(base, ".") {
-			continue
+	for _, name := range deckFiles(dataDir) {
+		if !ValidDeckName(name) && !strings.HasPrefix(name, ".") {
+			result = append(result, name)
 		}
-		result = append(result, strings.TrimSuffix(base, ".csv"))
 	}
 	return result
 }
 
-func DeckCSVPath(dataDir, deckName string) string {
-	return filepath.Join(dataDir, deckName+".csv")
+func deckFiles(dataDir string) []string {
+	files, _ := filepath.Glob(filepath.Join(dataDir, "*.csv"))
+	var names []string
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(f), ".csv"))
+	}
+	return names
+}
+
+func DeckCSVPath(dataDir string, deck DeckName) string {
+	return filepath.Join(dataDir, string(deck)+".csv")
 }
 
 func LoadCards(csvFile string) ([]Card, error) {
@@ -151,15 +208,31 @@ func LoadCards(csvFile string) ([]Card, error) {
 		return nil, err
 	}
 	defer file.Close()
+	return ReadCards(file, ',')
+}
 
-	rows, err := csv.NewReader(file).ReadAll()
+// ReadCards parses cards from CSV (comma ',') or TSV (comma '\t') data.
+// The first CSV row is a header and skipped, as in LoadCards. Anki's TSV
+// exports have no header, so there the first row is only skipped if it
+// reads front, back.
+func ReadCards(r io.Reader, comma rune) ([]Card, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	if comma == '\t' {
+		// Anki text exports start with "#separator:tab" style directives
+		// and don't quote fields.
+		cr.Comment = '#'
+		cr.LazyQuotes = true
+	}
+	rows, err := cr.ReadAll()
 	if err != nil {
 		return nil, err
 	}
 
 	var cards []Card
 	for i, row := range rows {
-		if i == 0 || len(row) < 2 {
+		if len(row) < 2 || i == 0 && (comma == ',' || isHeader(row)) {
 			continue
 		}
 
@@ -188,16 +261,22 @@ func LoadCards(csvFile string) ([]Card, error) {
 	return cards, nil
 }
 
+// isHeader reports whether row is the front,back header SaveCards writes.
+func isHeader(row []string) bool {
+	return strings.EqualFold(strings.TrimSpace(row[0]), "front") &&
+		strings.EqualFold(strings.TrimSpace(row[1]), "back")
+}
+
+// SaveCards writes the deck to a temp file and renames it into place, so an
+// interrupted write (power off, process killed) never leaves a truncated deck.
 func SaveCards(csvFile string, cards []Card) error {
-	file, err := os.Create(csvFile)
+	tmp := csvFile + ".tmp"
+	file, err := os.Create(tmp)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
 	w := csv.NewWriter(file)
-	defer w.Flush()
-
 	w.Write([]string{"front", "back", "due", "stability", "difficulty",
 		"elapsed_days", "scheduled_days", "reps", "lapses", "state", "last_review"})
 	for _, c := range cards {
@@ -214,7 +293,22 @@ func SaveCards(csvFile string, cards []Card) error {
 			formatTime(c.LastReview),
 		})
 	}
-	return nil
+	w.Flush()
+	if err := w.Error(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, csvFile)
 }
 
 func FindCard(cards []Card, front string) *Card {
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadCards(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		data   string
+		comma  rune
+		fronts []string
+	}{
+		{"csv", "front,back\nhallo,hello\nfiets,bicycle\n", ',', []string{"hallo", "fiets"}},
+		{"csv fsrs", "front,back,due,stability,difficulty,elapsed_days,scheduled_days,reps,lapses,state,last_review\n" +
+			"hallo,hello,2025-03-01T09:00:00Z,1.5,5,0,1,1,0,2,2025-02-28T09:00:00Z\n", ',', []string{"hallo"}},
+		{"anki tsv", "#separator:tab\n#html:true\nhallo\thello\nfiets\tbicycle\n", '\t', []string{"hallo", "fiets"}},
+		{"tsv with header", "Front\tBack\nhallo\thello\n", '\t', []string{"hallo"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cards, err := ReadCards(strings.NewReader(tc.data), tc.comma)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fronts []string
+			for _, c := range cards {
+				fronts = append(fronts, c.Front)
+			}
+			if strings.Join(fronts, "|") != strings.Join(tc.fronts, "|") {
+				t.Errorf("fronts %q, want %q", fronts, tc.fronts)
+			}
+		})
+	}
+}
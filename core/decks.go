@@ -0,0 +1,121 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MediaDir is the subdirectory of the data dir holding the images that
+// cards reference, next to the deck CSVs.
+const MediaDir = "media"
+
+// TrashDir is the subdirectory of the data dir that deleted decks are moved to.
+// ListDecks only globs the top level, so trashed decks disappear from the UI.
+const TrashDir = ".trash"
+
+var (
+	ErrInvalidDeckName = errors.New("invalid deck name")
+	ErrDeckExists      = errors.New("deck already exists")
+	ErrDeckNotFound    = errors.New("deck not found")
+	ErrInvalidMedia    = errors.New("invalid media file name")
+)
+
+// DeckName is a deck name that has been checked by ParseDeckName and is
+// safe to join onto the data dir. Use it for anything that came from a user.
+// A conversion can skip the check, so the functions that write to the data
+// dir check again.
+type DeckName string
+
+// ValidDeckName reports whether name can be used as a deck file name inside
+// the data dir: no path separators, no leading dot, no control characters.
+func ValidDeckName(name string) bool {
+	if name == "" || len(name) > 100 || name != strings.TrimSpace(name) {
+		return false
+	}
+	if strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\:`) {
+		return false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseDeckName validates a raw deck name, e.g. from a query parameter.
+func ParseDeckName(name string) (DeckName, error) {
+	if !ValidDeckName(name) {
+		return "", ErrInvalidDeckName
+	}
+	return DeckName(name), nil
+}
+
+// DeckExists reports whether a deck CSV with this name exists in dataDir.
+func DeckExists(dataDir string, deck DeckName) bool {
+	fi, err := os.Stat(DeckCSVPath(dataDir, deck))
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// MediaPath returns the path of a file in the media folder. Names follow
+// the deck name rules, so a card can't point outside the folder.
+func MediaPath(dataDir, name string) (string, error) {
+	if !ValidDeckName(name) {
+		return "", ErrInvalidMedia
+	}
+	return filepath.Join(dataDir, MediaDir, name), nil
+}
+
+// CreateDeck writes a new deck with the given cards (may be empty).
+// It refuses to overwrite an existing deck.
+func CreateDeck(dataDir string, name DeckName, cards []Card) error {
+	if !ValidDeckName(string(name)) {
+		return ErrInvalidDeckName
+	}
+	path := DeckCSVPath(dataDir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return ErrDeckExists
+		}
+		return err
+	}
+	f.Close()
+	return SaveCards(path, cards)
+}
+
+// RenameDeck renames a deck, refusing to overwrite an existing one.
+func RenameDeck(dataDir string, oldName, newName DeckName) error {
+	if !ValidDeckName(string(oldName)) || !ValidDeckName(string(newName)) {
+		return ErrInvalidDeckName
+	}
+	if !DeckExists(dataDir, oldName) {
+		return ErrDeckNotFound
+	}
+	if DeckExists(dataDir, newName) {
+		return ErrDeckExists
+	}
+	return os.Rename(DeckCSVPath(dataDir, oldName), DeckCSVPath(dataDir, newName))
+}
+
+// TrashDeck moves a deck into the trash folder instead of deleting it.
+// The file is timestamped so trashing a deck of the same name twice keeps both.
+func TrashDeck(dataDir string, name DeckName) error {
+	if !ValidDeckName(string(name)) {
+		return ErrInvalidDeckName
+	}
+	if !DeckExists(dataDir, name) {
+		return ErrDeckNotFound
+	}
+	trash := filepath.Join(dataDir, TrashDir)
+	if err := os.MkdirAll(trash, 0755); err != nil {
+		return err
+	}
+	dst := filepath.Join(trash, fmt.Sprintf("%s.%s.csv", name, time.Now().Format("20060102-150405")))
+	return os.Rename(DeckCSVPath(dataDir, name), dst)
+}
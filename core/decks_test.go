@@ -0,0 +1,54 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDeckNameChecked(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	if err := os.Mkdir(data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateDeck(data, "dutch", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Conversions skip ParseDeckName, so core must check again.
+	bad := DeckName("../escaped")
+	for name, err := range map[string]error{
+		"CreateDeck":     CreateDeck(data, bad, nil),
+		"RenameDeck new": RenameDeck(data, "dutch", bad),
+		"RenameDeck old": RenameDeck(data, bad, "dutch2"),
+		"TrashDeck":      TrashDeck(data, bad),
+	} {
+		if !errors.Is(err, ErrInvalidDeckName) {
+			t.Errorf("%s(%q) = %v, want ErrInvalidDeckName", name, bad, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.csv")); err == nil {
+		t.Error("deck created outside the data dir")
+	}
+	if !DeckExists(data, "dutch") {
+		t.Error("dutch was renamed to an invalid name")
+	}
+}
+
+func TestListDecks(t *testing.T) {
+	data := t.TempDir()
+	for _, name := range []string{"dutch", "a:b", " spaced", ".hidden"} {
+		if err := os.WriteFile(filepath.Join(data, name+".csv"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := ListDecks(data); !slices.Equal(got, []DeckName{"dutch"}) {
+		t.Errorf("ListDecks = %q, want [dutch]", got)
+	}
+	if got := InvalidDecks(data); !slices.Equal(got, []string{" spaced", "a:b"}) {
+		t.Errorf("InvalidDecks = %q, want [\" spaced\" a:b]", got)
+	}
+}
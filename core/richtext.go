@@ -0,0 +1,298 @@
+package core
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Card fields may use a small markup subset: the HTML tags <b>/<strong>,
+// <i>/<em>, <br>, <p>, <ul>/<ol>/<li>, and the Markdown equivalents
+// **bold**, *italic* or _italic_, and "- " or "* " list items (numbered
+// lines need no markup). Any other tag is dropped, keeping its text.
+// Images are referenced as <img src="file.png"> or ![alt](file.png), and
+// sounds as [sound:file.mp3] like Anki does; both are listed by Images and
+// Sounds rather than kept in the text.
+
+// Style is a set of inline text styles.
+type Style uint8
+
+const (
+	Bold Style = 1 << iota
+	Italic
+)
+
+// Span is a run of text in one style.
+type Span struct {
+	Text  string
+	Style Style
+}
+
+// Line is one line of styled text, as broken by the markup (not wrapped).
+type Line []Span
+
+// String returns the line's text without styles.
+func (l Line) String() string {
+	var sb strings.Builder
+	for _, sp := range l {
+		sb.WriteString(sp.Text)
+	}
+	return sb.String()
+}
+
+var (
+	tagRe      = regexp.MustCompile(`^<\s*(/?)\s*([a-zA-Z][a-zA-Z0-9]*)[^>]*>`)
+	mdBulletRe = regexp.MustCompile(`^\s*[-*]\s+`)
+	mdImageRe  = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)\)`)
+	soundRe    = regexp.MustCompile(`\[sound:([^\]]+)\]`)
+	imgTagRe   = regexp.MustCompile(`(?i)<\s*img\b[^>]*?\bsrc\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))[^>]*>`)
+)
+
+type listState struct {
+	ordered bool
+	n       int
+}
+
+type richParser struct {
+	lines  []Line
+	cur    Line
+	bold   int // open <b> tags
+	italic int // open <i> tags
+	mdBold bool
+	mdItal bool
+	lists  []listState
+}
+
+// ParseRich parses card text into lines of styled spans. Leading and
+// trailing blank lines are dropped.
+func ParseRich(s string) []Line {
+	p := &richParser{}
+	for s != "" {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			p.text(s)
+			break
+		}
+		p.text(s[:i])
+		s = s[i:]
+		m := tagRe.FindStringSubmatch(s)
+		if m == nil {
+			p.text("<")
+			s = s[1:]
+			continue
+		}
+		p.tag(m[1] == "/", strings.ToLower(m[2]))
+		s = s[len(m[0]):]
+	}
+	p.newline()
+
+	lines := p.lines
+	for len(lines) > 0 && len(lines[0]) == 0 {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func (p *richParser) style() Style {
+	var st Style
+	if p.bold > 0 || p.mdBold {
+		st |= Bold
+	}
+	if p.italic > 0 || p.mdItal {
+		st |= Italic
+	}
+	return st
+}
+
+func (p *richParser) emit(s string) {
+	if s == "" {
+		return
+	}
+	st := p.style()
+	if n := len(p.cur); n > 0 && p.cur[n-1].Style == st {
+		p.cur[n-1].Text += s
+		return
+	}
+	p.cur = append(p.cur, Span{s, st})
+}
+
+func (p *richParser) newline() {
+	p.lines = append(p.lines, p.cur)
+	p.cur = nil
+	p.mdBold, p.mdItal = false, false
+}
+
+// lineBreak ends the current line unless it is empty, so block tags next
+// to newlines don't stack up blank lines.
+func (p *richParser) lineBreak() {
+	if len(p.cur) > 0 {
+		p.newline()
+	}
+}
+
+func (p *richParser) tag(closing bool, name string) {
+	step := 1
+	if closing {
+		step = -1
+	}
+	switch name {
+	case "b", "strong":
+		p.bold = max(0, p.bold+step)
+	case "i", "em":
+		p.italic = max(0, p.italic+step)
+	case "br":
+		p.newline()
+	case "p", "div":
+		p.lineBreak()
+	case "ul", "ol":
+		p.lineBreak()
+		if closing {
+			if len(p.lists) > 0 {
+				p.lists = p.lists[:len(p.lists)-1]
+			}
+		} else {
+			p.lists = append(p.lists, listState{ordered: name == "ol"})
+		}
+	case "li":
+		p.lineBreak()
+		if closing {
+			return
+		}
+		indent := ""
+		marker := "• "
+		if n := len(p.lists); n > 0 {
+			indent = strings.Repeat("  ", n-1)
+			if l := &p.lists[n-1]; l.ordered {
+				l.n++
+				marker = strconv.Itoa(l.n) + ". "
+			}
+		}
+		p.cur = append(p.cur, Span{indent + marker, 0})
+	}
+}
+
+// text handles a run between tags: entities, newlines and Markdown.
+func (p *richParser) text(s string) {
+	s = soundRe.ReplaceAllString(mdImageRe.ReplaceAllString(s, ""), "")
+	s = html.UnescapeString(s)
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			p.newline()
+		}
+		if m := mdBulletRe.FindString(line); m != "" && len(p.cur) == 0 {
+			p.cur = append(p.cur, Span{"• ", 0})
+			line = line[len(m):]
+		}
+		p.inline(line)
+	}
+}
+
+// inline applies **bold**, *italic* and _italic_ markers. A marker only
+// opens before a non-space and closes after one, so "2 * 3" and snake_case
+// are left alone.
+func (p *richParser) inline(s string) {
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '*' && c != '_' {
+			continue
+		}
+		n := 1
+		if c == '*' && i+1 < len(s) && s[i+1] == '*' {
+			n = 2
+		}
+		prev, next := byte(' '), byte(' ')
+		if i > 0 {
+			prev = s[i-1]
+		}
+		if i+n < len(s) {
+			next = s[i+n]
+		}
+		open := &p.mdItal
+		if n == 2 {
+			open = &p.mdBold
+		}
+		var toggle bool
+		if *open {
+			toggle = prev != ' ' && !isWordByte(next)
+		} else {
+			toggle = next != ' ' && !isWordByte(prev) && strings.IndexByte(s[i+n:], c) >= 0
+		}
+		if !toggle {
+			continue
+		}
+		p.emit(s[start:i])
+		*open = !*open
+		i += n - 1
+		start = i + 1
+	}
+	p.emit(s[start:])
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// Images returns the file names of the images card text references, in
+// order. Names are not checked; see MediaPath.
+func Images(s string) []string {
+	var names []string
+	for _, m := range imgTagRe.FindAllStringSubmatch(s, -1) {
+		names = append(names, html.UnescapeString(m[1]+m[2]+m[3]))
+	}
+	for _, m := range mdImageRe.FindAllStringSubmatch(s, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// Sounds returns the file names of the [sound:...] references in card
+// text, in order. Names are not checked; see MediaPath.
+func Sounds(s string) []string {
+	var names []string
+	for _, m := range soundRe.FindAllStringSubmatch(s, -1) {
+		names = append(names, html.UnescapeString(m[1]))
+	}
+	return names
+}
+
+// PlainText returns card text with markup removed, lines joined by "\n".
+func PlainText(s string) string {
+	lines := ParseRich(s)
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = l.String()
+	}
+	return strings.Join(out, "\n")
+}
+
+// RichHTML renders card text as HTML using only <b>, <i> and <br>, with all
+// text escaped, so it is safe to embed however the field was written.
+func RichHTML(s string) string {
+	var sb strings.Builder
+	for i, l := range ParseRich(s) {
+		if i > 0 {
+			sb.WriteString("<br>")
+		}
+		for _, sp := range l {
+			if sp.Style&Bold != 0 {
+				sb.WriteString("<b>")
+			}
+			if sp.Style&Italic != 0 {
+				sb.WriteString("<i>")
+			}
+			sb.WriteString(html.EscapeString(sp.Text))
+			if sp.Style&Italic != 0 {
+				sb.WriteString("</i>")
+			}
+			if sp.Style&Bold != 0 {
+				sb.WriteString("</b>")
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRich(t *testing.T) {
+	for in, want := range map[string][]Line{
+		"plain":                    {{{"plain", 0}}},
+		"a <b>bold</b> word":       {{{"a ", 0}, {"bold", Bold}, {" word", 0}}},
+		"<i>x</i><br>y":            {{{"x", Italic}}, {{"y", 0}}},
+		"**bold** and *it*":        {{{"bold", Bold}, {" and ", 0}, {"it", Italic}}},
+		"<b>_both_</b>":            {{{"both", Bold | Italic}}},
+		"2 * 3 * 4 snake_case_var": {{{"2 * 3 * 4 snake_case_var", 0}}},
+		"<ul><li>one</li><li>two</li></ul>": {
+			{{"• one", 0}}, {{"• two", 0}}},
+		"<ol><li>a<li>b</ol>":        {{{"1. a", 0}}, {{"2. b", 0}}},
+		"- one\n- **two**":           {{{"• one", 0}}, {{"• ", 0}, {"two", Bold}}},
+		"<p>x &amp; y</p><p>z</p>":   {{{"x & y", 0}}, {{"z", 0}}},
+		"<span class=a>k</span> < 5": {{{"k < 5", 0}}},
+		"<script>alert(1)</script>":  {{{"alert(1)", 0}}},
+		"<img src=\"a.png\">cat":     {{{"cat", 0}}},
+		"![a cat](cat.jpg)\ncat":     {{{"cat", 0}}},
+		"fiets [sound:fiets.mp3]":    {{{"fiets ", 0}}},
+	} {
+		if got := ParseRich(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseRich(%q) =\n  %v\nwant\n  %v", in, got, want)
+		}
+	}
+}
+
+func TestImages(t *testing.T) {
+	got := Images(`<img src="a.png"> <IMG alt=x src='b &amp; c.jpg'/> <img src=d.gif> ![e](e.png)`)
+	want := []string{"a.png", "b & c.jpg", "d.gif", "e.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Images = %q, want %q", got, want)
+	}
+	if got := Sounds("[sound:a.mp3]<br>b [sound:c &amp; d.mp3]"); !reflect.DeepEqual(got, []string{"a.mp3", "c & d.mp3"}) {
+		t.Errorf("Sounds = %q", got)
+	}
+	for _, name := range []string{"../x.png", "/etc/passwd", "http://x/y.png", ""} {
+		if _, err := MediaPath("data", name); err == nil {
+			t.Errorf("MediaPath accepted %q", name)
+		}
+	}
+}
+
+func TestRichHTML(t *testing.T) {
+	got := RichHTML(`<b>a&lt;b</b><br><img src=x onerror=alert(1)>*c*`)
+	want := `<b>a&lt;b</b><br><i>c</i>`
+	if got != want {
+		t.Errorf("RichHTML = %q, want %q", got, want)
+	}
+	if got := PlainText("<b>x</b><br>- y"); got != "x\n• y" {
+		t.Errorf("PlainText = %q", got)
+	}
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/open-spaced-repetition/go-fsrs/v3"
+)
+
+// Session counts what happened while studying a deck in one sitting.
+type Session struct {
+	Deck    DeckName
+	Start   time.Time
+	Last    time.Time // time of the latest review; Start if none
+	Ratings [5]int    // reviews per fsrs.Rating (index 0 unused)
+	New     int       // cards seen for the first time
+	Lapses  int       // review cards that were forgotten
+}
+
+// NewSession starts a session on deck at now.
+func NewSession(deck DeckName, now time.Time) Session {
+	return Session{Deck: deck, Start: now, Last: now}
+}
+
+// Review schedules card like the package-level Review and counts it.
+func (s *Session) Review(card *Card, rating fsrs.Rating) {
+	if card.State == fsrs.New {
+		s.New++
+	}
+	lapses := card.Lapses
+	Review(card, rating)
+	if card.Lapses > lapses {
+		s.Lapses++
+	}
+	if rating >= fsrs.Again && rating <= fsrs.Easy {
+		s.Ratings[rating]++
+	}
+	s.Last = time.Now()
+}
+
+// Reviews is the number of cards rated in the session.
+func (s Session) Reviews() int {
+	return s.Ratings[fsrs.Again] + s.Ratings[fsrs.Hard] + s.Ratings[fsrs.Good] + s.Ratings[fsrs.Easy]
+}
+
+// Duration is the time from the start to the last review.
+func (s Session) Duration() time.Duration {
+	return s.Last.Sub(s.Start)
+}
+
+// NextDue returns when the next card in cards comes due, or the zero time
+// if there are no cards.
+func NextDue(cards []Card) time.Time {
+	var next time.Time
+	for _, c := range cards {
+		if next.IsZero() || c.Due.Before(next) {
+			next = c.Due
+		}
+	}
+	return next
+}
+
+// FormatInterval renders a duration compactly, the way Anki labels
+// intervals: 10m, 5h, 4d, 3.5mo, 1.2y.
+func FormatInterval(d time.Duration) string {
+	switch days := d.Hours() / 24; {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", max(int(d.Round(time.Minute).Minutes()), 1))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Round(time.Hour).Hours()))
+	case days < 30:
+		return fmt.Sprintf("%dd", int(days+0.5))
+	case days < 365:
+		return fmt.Sprintf("%.1fmo", days/30)
+	default:
+		return fmt.Sprintf("%.1fy", days/365)
+	}
+}
+
+// FormatDue describes when a due time comes relative to now, e.g. "now" or
+// "in 5h".
+func FormatDue(due, now time.Time) string {
+	if !due.After(now) {
+		return "now"
+	}
+	return "in " + FormatInterval(due.Sub(now))
+}
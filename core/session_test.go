@@ -0,0 +1,73 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-spaced-repetition/go-fsrs/v3"
+)
+
+func TestSession(t *testing.T) {
+	s := NewSession("dutch", time.Now())
+	newCard := Card{Front: "a", State: fsrs.New}
+	s.Review(&newCard, fsrs.Good)
+	review := Card{Front: "b", State: fsrs.Review, Stability: 10, Difficulty: 5, Reps: 3,
+		LastReview: time.Now().AddDate(0, 0, -10), Due: time.Now()}
+	s.Review(&review, fsrs.Again)
+	s.Review(&review, fsrs.Good)
+	if s.Reviews() != 3 || s.Ratings[fsrs.Good] != 2 || s.Ratings[fsrs.Again] != 1 {
+		t.Errorf("ratings %v", s.Ratings)
+	}
+	if s.New != 1 || s.Lapses != 1 {
+		t.Errorf("new %d, lapses %d; want 1, 1", s.New, s.Lapses)
+	}
+	if next := NextDue([]Card{newCard, review}); !next.Equal(minTime(newCard.Due, review.Due)) {
+		t.Errorf("NextDue = %v", next)
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func TestFormatInterval(t *testing.T) {
+	now := time.Now()
+	for d, want := range map[time.Duration]string{
+		10 * time.Second:     "1m",
+		10 * time.Minute:     "10m",
+		5 * time.Hour:        "5h",
+		4 * 24 * time.Hour:   "4d",
+		105 * 24 * time.Hour: "3.5mo",
+		438 * 24 * time.Hour: "1.2y",
+	} {
+		if got := FormatInterval(d); got != want {
+			t.Errorf("FormatInterval(%v) = %q, want %q", d, got, want)
+		}
+	}
+	if got := FormatDue(now.Add(-time.Minute), now); got != "now" {
+		t.Errorf("FormatDue(past) = %q", got)
+	}
+	if got := FormatDue(now.Add(3*time.Hour), now); got != "in 3h" {
+		t.Errorf("FormatDue(3h) = %q", got)
+	}
+}
+
+func TestIntervals(t *testing.T) {
+	card := Card{Front: "b", State: fsrs.Review, Stability: 10, Difficulty: 5, Reps: 3,
+		LastReview: time.Now().AddDate(0, 0, -10), Due: time.Now()}
+	d := Intervals(card, time.Now())
+	if !(d[fsrs.Again] < d[fsrs.Hard] && d[fsrs.Hard] < d[fsrs.Good] && d[fsrs.Good] < d[fsrs.Easy]) {
+		t.Fatalf("intervals not increasing: %v", d)
+	}
+	reviewed := card
+	Review(&reviewed, fsrs.Good)
+	if got := time.Until(reviewed.Due); (got - d[fsrs.Good]).Abs() > time.Minute {
+		t.Errorf("Good interval %v, but Review scheduled %v", d[fsrs.Good], got)
+	}
+	if card.Reps != 3 {
+		t.Error("Intervals changed the card")
+	}
+}
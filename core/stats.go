@@ -0,0 +1,69 @@
+package core
+
+import (
+	"time"
+
+	"github.com/open-spaced-repetition/go-fsrs/v3"
+)
+
+// DeckStats summarizes a deck's cards for stats screens.
+type DeckStats struct {
+	Total    int
+	New      int
+	Learning int // learning and relearning
+	Review   int
+
+	DueToday    int // due by the end of today, overdue included
+	DueTomorrow int // coming due during tomorrow
+
+	AvgDifficulty float64 // over cards reviewed at least once; 0 if none
+	Lapses        int     // total over all cards
+
+	// Forecast counts the cards coming due on each of the next days,
+	// starting with today (overdue included).
+	Forecast []int
+}
+
+// Stats summarizes cards as of now, with a forecast of the given length.
+func Stats(cards []Card, now time.Time, days int) DeckStats {
+	s := DeckStats{Total: len(cards), Forecast: make([]int, days)}
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	var difficulty float64
+	var reviewed int
+	for _, c := range cards {
+		switch c.State {
+		case fsrs.New:
+			s.New++
+		case fsrs.Learning, fsrs.Relearning:
+			s.Learning++
+		default:
+			s.Review++
+		}
+		if c.Reps > 0 {
+			difficulty += c.Difficulty
+			reviewed++
+		}
+		s.Lapses += int(c.Lapses)
+
+		// Calendar days from today, so a card due at 23:00 counts today.
+		day := 0
+		if c.Due.After(today) {
+			dy, dm, dd := c.Due.In(now.Location()).Date()
+			day = int(time.Date(dy, dm, dd, 0, 0, 0, 0, now.Location()).Sub(today).Hours()+12) / 24
+		}
+		switch day {
+		case 0:
+			s.DueToday++
+		case 1:
+			s.DueTomorrow++
+		}
+		if day < days {
+			s.Forecast[day]++
+		}
+	}
+	if reviewed > 0 {
+		s.AvgDifficulty = difficulty / float64(reviewed)
+	}
+	return s
+}
@@ -0,0 +1,31 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/open-spaced-repetition/go-fsrs/v3"
+)
+
+func TestStats(t *testing.T) {
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.Local)
+	cards := []Card{
+		{State: fsrs.New}, // zero due date: due now
+		{State: fsrs.New, Due: now.Add(-time.Hour)},
+		{State: fsrs.Learning, Due: now.Add(8 * time.Hour), Reps: 1, Difficulty: 6}, // 23:00 today
+		{State: fsrs.Relearning, Due: now.Add(10 * time.Hour), Reps: 3, Difficulty: 8, Lapses: 1},
+		{State: fsrs.Review, Due: now.AddDate(0, 0, 3), Reps: 5, Difficulty: 4, Lapses: 2},
+		{State: fsrs.Review, Due: now.AddDate(0, 0, 30), Reps: 9, Difficulty: 2},
+	}
+	got := Stats(cards, now, 5)
+	want := DeckStats{
+		Total: 6, New: 2, Learning: 2, Review: 2,
+		DueToday: 3, DueTomorrow: 1,
+		AvgDifficulty: 5, Lapses: 3,
+		Forecast: []int{3, 1, 0, 1, 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats =\n  %+v\nwant\n  %+v", got, want)
+	}
+}
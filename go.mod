@@ -2,4 +2,9 @@ module kobo-anki
 
 go 1.22.2
 
-require github.com/open-spaced-repetition/go-fsrs/v3 v3.3.1 // indirect
+require github.com/open-spaced-repetition/go-fsrs/v3 v3.3.1
+
+require (
+	golang.org/x/image v0.24.0
+	golang.org/x/text v0.22.0 // indirect
+)
@@ -54,6 +54,6 @@ start_watchdog
 ./bin/kobo-vocab -conf anki-mywords.conf 2>&1 | tee -a $LOG
 
 ./bin/fbink -c -f
-DEBUG=1 ./bin/kobo-anki-fbink 2>&1 | tee -a $LOG
+DEBUG=1 ./bin/kobo-anki-fbink "$@" 2>&1 | tee -a $LOG
 
 # cleanup runs via EXIT trap — prints reminder to reboot
@@ -67,8 +67,10 @@ MAX_CRASHES=5
 
 while true; do
     ./bin/fbink -c -f
-    ./bin/kobo-anki-fbink >>$LOG 2>&1
+    ./bin/kobo-anki-fbink "$@" >>$LOG 2>&1
     RC=$?
+    # Flags such as -calibrate only apply to the first run, not restarts
+    set --
 
     # Clean exit
     [ "$RC" -eq 0 ] && break
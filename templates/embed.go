@@ -0,0 +1,8 @@
+// Package templates holds the default HTML templates for kobo-anki-server,
+// embedded so the binary works without a templates/ directory on the device.
+package templates
+
+import "embed"
+
+//go:embed *.html
+var FS embed.FS